@@ -1,29 +1,78 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/muscleandstrength/GoShiphawkRates/internal/api"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/breaker"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/currency"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/health"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/middleware"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/services"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/transport"
 )
 
 func main() {
+	configPath := flag.String("config", "", "Path to YAML config file (default $GOSHIPHAWK_CONFIG or ./config.yaml)")
+	profile := flag.String("profile", "", "Config profile: dev, staging or prod (default $GOSHIPHAWK_PROFILE or the file's profile)")
+	dumpConfig := flag.Bool("dump-config", false, "Print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(config.Options{Path: *configPath, Profile: *profile})
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if *dumpConfig {
+		if err := cfg.Dump(os.Stdout); err != nil {
+			log.Fatalf("Failed to dump configuration: %v", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration is invalid:\n%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration (profile %s):\n%v", cfg.Profile, err)
+	}
+	trustedProxies, _ := cfg.Server.TrustedProxyPrefixes()
+
+	// Shared, tuned HTTP clients for every upstream provider
+	clients, err := transport.NewFactory(cfg.HTTPClient, cfg.Retry, transport.WithCassette(cfg.Cassette))
+	if err != nil {
+		log.Fatalf("Failed to create HTTP clients: %v", err)
+	}
+	switch cfg.Cassette.Mode {
+	case transport.CassetteRecord:
+		log.Printf("WARNING: recording upstream exchanges to %s", cfg.Cassette.Dir)
+	case transport.CassetteReplay:
+		log.Printf("WARNING: replaying upstream exchanges from %s; ShipHawk and USPS will not be called", cfg.Cassette.Dir)
+	}
+	shipHawkClient := clients.Client("shiphawk")
+
 	// Create services
-	shipHawkService := services.NewShipHawkService(cfg)
-	carrierService := services.NewCarrierService(cfg)
+	shipHawkService := services.NewShipHawkService(cfg, shipHawkClient)
+	carrierService := services.NewCarrierService(cfg, shipHawkClient)
 
-	// Create USPS service
-	uspsService, err := services.NewUSPSService()
+	// Create USPS service; this fetches an OAuth token to verify credentials,
+	// failing only if USPS rejects them
+	startupCtx, cancelStartup := context.WithTimeout(context.Background(), 30*time.Second)
+	uspsService, err := services.NewUSPSService(startupCtx, cfg, clients.Client("usps"))
+	cancelStartup()
 	if err != nil {
 		log.Fatalf("Failed to create USPS service: %v", err)
 	}
@@ -33,29 +82,104 @@ func main() {
 		log.Fatalf("Failed to initialize carrier service: %v", err)
 	}
 
+	// Exchange rates for quoting in a storefront's currency
+	converter := currency.NewConverter(currency.NewSource(cfg.Currency, clients.Client("currency")), cfg.Currency.CacheTTL)
+
 	// Create handlers
-	handler := api.NewHandler(shipHawkService, uspsService, carrierService)
+	handler := api.NewHandler(shipHawkService, uspsService, carrierService, converter, cfg.Server.QuoteTimeout)
+
+	// Readiness checks; upstream probes are cached so frequent polling
+	// doesn't hammer ShipHawk or the USPS token endpoint.
+	checker := health.NewChecker(10 * time.Second)
+	checker.Add("carriers", 0, carrierService.Ping)
+	checker.Add("shiphawk", cfg.Server.HealthCheckTTL, shipHawkService.Ping)
+	checker.Add("usps_oauth", cfg.Server.HealthCheckTTL, uspsService.Ping)
+	healthHandler := api.NewHealthHandler(checker)
 
 	// Create a new HTTP server mux
 	mux := http.NewServeMux()
 
+	// API key authentication
+	auth := middleware.NewAuth(cfg.Auth.Keys, cfg.Auth.Disabled)
+	if cfg.Auth.Disabled {
+		log.Printf("WARNING: API authentication disabled (AUTH_DISABLED=true)")
+	}
+
+	// Per-client rate limits, applied after authentication so clients are
+	// keyed by API key where possible. The IP limit runs before
+	// authentication so failed attempts to guess a key are limited too.
+	ipLimiter := middleware.NewRateLimiter("ip", cfg.RateLimits["ip"], trustedProxies)
+	carriersLimiter := middleware.NewRateLimiter("carriers", cfg.RateLimits["carriers"], trustedProxies)
+	quoteLimiter := middleware.NewRateLimiter("quote", cfg.RateLimits["quote"], trustedProxies)
+
 	// API routes
-	mux.HandleFunc("GET /api/carriers", handler.GetCarriers)
-	mux.HandleFunc("POST /api/quote", handler.GetRateQuotes)
+	mux.Handle("GET /api/carriers", ipLimiter.Limit(auth.Require(middleware.ScopeCarriers, carriersLimiter.Limit(http.HandlerFunc(handler.GetCarriers)))))
+	mux.Handle("POST /api/quote", ipLimiter.Limit(auth.Require(middleware.ScopeQuote, quoteLimiter.Limit(http.HandlerFunc(handler.GetRateQuotes)))))
+
+	// Admin routes
+	breakers := []*breaker.Breaker{shipHawkService.Breaker()}
+	if uspsService.Enabled() {
+		breakers = append(breakers, uspsService.Breaker())
+	}
+	adminHandler := api.NewAdminHandler(breakers)
+	mux.Handle("GET /api/admin/breakers", ipLimiter.Limit(auth.Require(middleware.ScopeAdmin, http.HandlerFunc(adminHandler.GetBreakers))))
+
+	// Health probes
+	mux.HandleFunc("GET /healthz", healthHandler.Healthz)
+	mux.HandleFunc("GET /readyz", healthHandler.Readyz)
+
+	// Prometheus metrics
+	mux.Handle("GET /metrics", metrics.Handler())
 
 	// Serve static files for the frontend (React build output)
 	fileServer := http.FileServer(http.Dir("./dist"))
 	mux.Handle("/", fileServer)
 
-	// Add middleware for CORS
-	handlerWithMiddleware := middleware.CORS(mux)
+	// Add middleware for CORS and request metrics
+	handlerWithMiddleware := middleware.CORS(cfg.CORS)(middleware.Metrics(mux))
+
+	// Requests derive their context from baseCtx, so cancelling it aborts any
+	// upstream ShipHawk/USPS calls still running after the grace period.
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
 
 	// Create server
 	server := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: handlerWithMiddleware,
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           handlerWithMiddleware,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
 	}
 
-	fmt.Printf("Server starting on port %s...\n", cfg.Port)
-	log.Fatal(server.ListenAndServe())
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("Server starting on port %s...\n", cfg.Server.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Wait for SIGINT/SIGTERM (systemd stop/restart) or a listener failure
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErr:
+		log.Fatalf("Server failed: %v", err)
+	case <-sigCtx.Done():
+		stop()
+	}
+
+	log.Printf("Shutting down, draining in-flight requests for up to %s...", cfg.Server.ShutdownGracePeriod)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownGracePeriod)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Grace period expired, aborting remaining requests: %v", err)
+		cancelBase()
+		_ = server.Close()
+		return
+	}
+	log.Printf("Server stopped")
 }
@@ -3,14 +3,18 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/fatih/color"
 
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/transport"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/usps"
 )
 
@@ -23,6 +27,8 @@ func main() {
 	width := flag.Float64("width", 5.0, "Package width in inches")
 	height := flag.Float64("height", 3.0, "Package height in inches")
 	verbose := flag.Bool("verbose", false, "Verbose output")
+	configPath := flag.String("config", "", "Path to YAML config file (default $GOSHIPHAWK_CONFIG or ./config.yaml)")
+	profile := flag.String("profile", "", "Config profile: dev, staging or prod")
 	flag.Parse()
 
 	// Validate required flags
@@ -32,29 +38,73 @@ func main() {
 		os.Exit(1)
 	}
 
+	cfg, err := config.Load(config.Options{Path: *configPath, Profile: *profile})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	clients, err := transport.NewFactory(cfg.HTTPClient, cfg.Retry, transport.WithCassette(cfg.Cassette))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating HTTP client: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Price with the configured defaults, as the API does; this tool only
+	// quotes domestic ZIPs, so international mail classes are dropped.
+	pricing, err := usps.ParsePricing(cfg.USPS.MailClasses, cfg.USPS.PriceType, cfg.USPS.AccountType, cfg.USPS.AccountNumber)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid USPS pricing configuration: %v\n", err)
+		os.Exit(1)
+	}
+	mailClasses := slices.DeleteFunc(slices.Clone(pricing.MailClasses), usps.MailClass.International)
+	if len(mailClasses) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: usps.mail_classes has no domestic mail classes")
+		os.Exit(1)
+	}
+
 	// Create USPS service
-	service, err := usps.NewRateService()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	service, err := usps.NewRateService(usps.Config{
+		USPSConsumerKey:    cfg.USPS.ConsumerKey,
+		USPSConsumerSecret: cfg.USPS.ConsumerSecret,
+		USPSBaseURL:        cfg.USPS.BaseURL,
+		HTTPClient:         clients.Client("usps"),
+	})
+	if err == nil {
+		err = service.Authenticate(ctx)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating USPS service: %v\n", err)
+		var configErr *usps.ConfigError
+		switch {
+		case errors.As(err, &configErr):
+			fmt.Fprintf(os.Stderr, "USPS is not configured: %v\n", err)
+		case errors.Is(err, usps.ErrInvalidCredentials):
+			fmt.Fprintf(os.Stderr, "USPS credentials were rejected; check the consumer key and secret for %s\n  %v\n", cfg.USPS.BaseURL, err)
+		default:
+			fmt.Fprintf(os.Stderr, "Could not reach the USPS token endpoint at %s: %v\n", cfg.USPS.BaseURL, err)
+		}
 		os.Exit(1)
 	}
 
 	// Create rate request
 	req := usps.RateRequest{
-		FromZipCode: *fromZip,
-		ToZipCode:   *toZip,
-		Weight:      *weight,
-		Length:      *length,
-		Width:       *width,
-		Height:      *height,
-		MailClasses: []usps.MailClass{usps.PriorityMailExpress, usps.PriorityMail, usps.GroundAdvantage},
-		PriceType:   "COMMERCIAL",
-		MailingDate: time.Now().AddDate(0, 0, 3).Format("2006-01-02"),
-		AccountType: "EPS",
+		FromZipCode:   *fromZip,
+		ToZipCode:     *toZip,
+		Weight:        *weight,
+		Length:        *length,
+		Width:         *width,
+		Height:        *height,
+		MailClasses:   mailClasses,
+		PriceType:     pricing.PriceType,
+		MailingDate:   time.Now().AddDate(0, 0, 3).Format("2006-01-02"),
+		AccountType:   pricing.AccountType,
+		AccountNumber: pricing.AccountNumber,
 	}
 	log.Printf("Mailing date: %s", req.MailingDate)
 	// Get rates
-	rates, err := service.GetRates(context.Background(), req)
+	rates, err := service.GetRates(ctx, req)
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Error getting rates: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/fakerates"
+)
+
+func main() {
+	addr := flag.String("addr", ":8092", "Listen address")
+	ratesPath := flag.String("rates", "", "JSON rate table file (default: built-in USD rates)")
+	flag.Parse()
+
+	rates := fakerates.Default()
+	if *ratesPath != "" {
+		var err error
+		if rates, err = fakerates.LoadRates(*ratesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	server := fakerates.New(rates)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		server.ServeHTTP(w, r)
+	})
+
+	fmt.Printf("Fake exchange rates listening on %s (set CURRENCY_SOURCE=http CURRENCY_RATES_URL=http://localhost%s/rates)...\n", *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
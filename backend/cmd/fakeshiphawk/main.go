@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/fakeshiphawk"
+)
+
+func main() {
+	addr := flag.String("addr", ":8090", "Listen address")
+	scenario := flag.String("scenario", "ok", "Built-in scenario: "+strings.Join(fakeshiphawk.ScenarioNames(), ", "))
+	fixturesPath := flag.String("fixtures", "", "JSON fixtures file (overrides -scenario)")
+	apiKey := flag.String("api-key", "", "Require this X-API-Key (default: accept any)")
+	flag.Parse()
+
+	var (
+		fixtures fakeshiphawk.Fixtures
+		err      error
+	)
+	if *fixturesPath != "" {
+		fixtures, err = fakeshiphawk.LoadFixtures(*fixturesPath)
+	} else {
+		fixtures, err = fakeshiphawk.Scenario(*scenario)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	server := fakeshiphawk.New(fixtures, *apiKey)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		server.ServeHTTP(w, r)
+	})
+
+	fmt.Printf("Fake ShipHawk listening on %s (set SHIPHAWK_BASE_URL=http://localhost%s)...\n", *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/fakeusps"
+)
+
+func main() {
+	addr := flag.String("addr", ":8091", "Listen address")
+	fixturesPath := flag.String("fixtures", "", "JSON fixtures file (default: built-in rate options)")
+	clientID := flag.String("client-id", "", "Require this consumer key (default: accept any)")
+	clientSecret := flag.String("client-secret", "", "Require this consumer secret (default: accept any)")
+	flag.Parse()
+
+	fixtures := fakeusps.Default()
+	if *fixturesPath != "" {
+		var err error
+		if fixtures, err = fakeusps.LoadFixtures(*fixturesPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	server := fakeusps.New(fixtures, fakeusps.Credentials{ClientID: *clientID, ClientSecret: *clientSecret})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		server.ServeHTTP(w, r)
+	})
+
+	fmt.Printf("Fake USPS listening on %s (set USPS_BASE_URL=http://localhost%s)...\n", *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, handler))
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/breaker"
+)
+
+// AdminHandler serves operational endpoints for the admin scope
+type AdminHandler struct {
+	breakers []*breaker.Breaker
+}
+
+// NewAdminHandler creates a new AdminHandler instance
+func NewAdminHandler(breakers []*breaker.Breaker) *AdminHandler {
+	return &AdminHandler{breakers: breakers}
+}
+
+// GetBreakers reports the state of each provider's circuit breaker
+func (h *AdminHandler) GetBreakers(w http.ResponseWriter, r *http.Request) {
+	statuses := make([]breaker.Status, 0, len(h.breakers))
+	for _, b := range h.breakers {
+		statuses = append(statuses, b.Status())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"breakers": statuses})
+}
@@ -1,13 +1,21 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/muscleandstrength/GoShiphawkRates/internal/currency"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/destination"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/services"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/units"
 )
 
 // Handler struct holds the service dependencies
@@ -15,17 +23,46 @@ type Handler struct {
 	shipHawkService *services.ShipHawkService
 	uspsService     *services.USPSService
 	carrierService  *services.CarrierService
+	currency        *currency.Converter
+	quoteTimeout    time.Duration
 }
 
-// NewHandler creates a new Handler instance
-func NewHandler(shipHawkService *services.ShipHawkService, uspsService *services.USPSService, carrierService *services.CarrierService) *Handler {
+// NewHandler creates a new Handler instance. Upstream calls for a quote
+// are given quoteTimeout to finish; zero means only the request's own
+// context bounds them.
+func NewHandler(shipHawkService *services.ShipHawkService, uspsService *services.USPSService, carrierService *services.CarrierService, converter *currency.Converter, quoteTimeout time.Duration) *Handler {
 	return &Handler{
 		shipHawkService: shipHawkService,
 		uspsService:     uspsService,
 		carrierService:  carrierService,
+		currency:        converter,
+		quoteTimeout:    quoteTimeout,
 	}
 }
 
+// candidateCarriers returns the carriers a quote would ask ShipHawk for:
+// those named in filter, or every enabled carrier when it is empty.
+func (h *Handler) candidateCarriers(filter []string) []models.Carrier {
+	known := h.carrierService.GetCarriers()
+	if len(filter) == 0 {
+		var enabled []models.Carrier
+		for _, carrier := range known {
+			if carrier.IsEnabled {
+				enabled = append(enabled, carrier)
+			}
+		}
+		return enabled
+	}
+	carriers := make([]models.Carrier, len(filter))
+	for i, code := range filter {
+		carriers[i] = models.Carrier{Code: code}
+		if j := slices.IndexFunc(known, func(c models.Carrier) bool { return strings.EqualFold(c.Code, code) }); j >= 0 {
+			carriers[i] = known[j]
+		}
+	}
+	return carriers
+}
+
 // GetCarriers handles the carriers request
 func (h *Handler) GetCarriers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -63,44 +100,122 @@ func (h *Handler) GetRateQuotes(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
+	// Providers all work in pounds and inches
+	if err := units.Normalize(&shipmentReq); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if shipmentReq.Currency != "" {
+		if err := h.currency.Check(r.Context(), shipmentReq.Currency); err != nil {
+			http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := h.uspsService.Validate(r.Context(), &shipmentReq); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Territories, military and PO Box destinations limit which carriers
+	// can deliver; rates from the others are filtered out below.
+	dest := destination.Classify(&shipmentReq)
+	if dest.Restricted() {
+		log.Printf("Restricted destination: %+v", dest)
+	}
 
 	// Create a combined response
 	combinedResponse := models.ShipHawkResponse{
 		Rates: []models.Rate{},
 	}
 
-	// Get rate quotes from ShipHawk — may return a non-nil response even on error
-	// (e.g. 422 with per-carrier error messages in the body).
-	shipHawkResp, err := h.shipHawkService.GetRateQuotes(&shipmentReq)
-	if shipHawkResp != nil {
-		combinedResponse.Rates = append(combinedResponse.Rates, shipHawkResp.Rates...)
-		combinedResponse.Errors = append(combinedResponse.Errors, shipHawkResp.Errors...)
-		combinedResponse.Warnings = append(combinedResponse.Warnings, shipHawkResp.Warnings...)
-		combinedResponse.Debug = shipHawkResp.Debug
-	}
-	if err != nil {
-		log.Printf("Error getting ShipHawk rates: %v", err)
-		if shipHawkResp == nil {
-			combinedResponse.Errors = append(combinedResponse.Errors, models.ShipHawkError{
-				Message:     err.Error(),
-				CarrierName: "ShipHawk",
-			})
+	// Don't ask ShipHawk for carriers that can't deliver to a restricted
+	// destination; with none left, ShipHawk isn't called at all.
+	quoteShipHawk := true
+	if dest.Restricted() {
+		if carriers := h.candidateCarriers(shipmentReq.CarrierFilter); len(carriers) > 0 {
+			codes, warnings := dest.Carriers(carriers)
+			combinedResponse.Warnings = append(combinedResponse.Warnings, warnings...)
+			shipmentReq.CarrierFilter = codes
+			quoteShipHawk = len(codes) > 0
 		}
 	}
 
+	// Providers are quoted side by side under one deadline, short of the
+	// server's write timeout, so a slow upstream costs only its own rates.
+	quoteCtx := r.Context()
+	if h.quoteTimeout > 0 {
+		var cancel context.CancelFunc
+		quoteCtx, cancel = context.WithTimeout(quoteCtx, h.quoteTimeout)
+		defer cancel()
+	}
+
 	// Get rate quotes from the direct USPS integration (skipped when disabled).
+	type uspsResult struct {
+		resp *models.ShipHawkResponse
+		err  error
+	}
+	uspsDone := make(chan uspsResult, 1)
 	if h.uspsService.Enabled() {
-		uspsRates, err := h.uspsService.GetRateQuotes(&shipmentReq)
+		go func() {
+			resp, err := h.uspsService.GetRateQuotes(quoteCtx, &shipmentReq)
+			uspsDone <- uspsResult{resp, err}
+		}()
+	} else {
+		close(uspsDone)
+	}
+
+	if quoteShipHawk {
+		// Get rate quotes from ShipHawk — may return a non-nil response even on error
+		// (e.g. 422 with per-carrier error messages in the body).
+		shipHawkResp, err := h.shipHawkService.GetRateQuotes(quoteCtx, &shipmentReq)
+		if shipHawkResp != nil {
+			combinedResponse.Rates = append(combinedResponse.Rates, shipHawkResp.Rates...)
+			combinedResponse.Errors = append(combinedResponse.Errors, shipHawkResp.Errors...)
+			combinedResponse.Warnings = append(combinedResponse.Warnings, shipHawkResp.Warnings...)
+			combinedResponse.Debug = shipHawkResp.Debug
+		}
 		if err != nil {
-			log.Printf("Error getting USPS rates: %v", err)
+			log.Printf("Error getting ShipHawk rates: %v", err)
+			// Per-carrier errors explain a 422; anything else needs the error itself
+			if shipHawkResp == nil || len(shipHawkResp.Errors) == 0 {
+				combinedResponse.Errors = append(combinedResponse.Errors, models.ShipHawkError{
+					Message:     err.Error(),
+					CarrierName: "ShipHawk",
+				})
+			}
+		}
+	}
+
+	if usps, ok := <-uspsDone; ok {
+		if usps.err != nil {
+			log.Printf("Error getting USPS rates: %v", usps.err)
 			combinedResponse.Errors = append(combinedResponse.Errors, models.ShipHawkError{
-				Message:     err.Error(),
+				Message:     usps.err.Error(),
 				CarrierName: "USPS",
 				CarrierCode: "usps",
 			})
 		} else {
-			combinedResponse.Rates = append(combinedResponse.Rates, uspsRates...)
+			combinedResponse.Rates = append(combinedResponse.Rates, usps.resp.Rates...)
+			combinedResponse.Warnings = append(combinedResponse.Warnings, usps.resp.Warnings...)
+		}
+	}
+
+	dest.Filter(&combinedResponse)
+
+	for i, rate := range combinedResponse.Rates {
+		// Rates without priced extras cost their base price
+		if rate.TotalPrice == "" {
+			combinedResponse.Rates[i].TotalPrice = rate.Price
+		}
+		// and without itemized surcharges their base price is the price
+		if rate.BasePrice == "" {
+			combinedResponse.Rates[i].BasePrice = rate.Price
 		}
+		metrics.QuotesServed.WithLabelValues(rate.RatesProvider, rate.CarrierCode).Inc()
+	}
+
+	if shipmentReq.Currency != "" {
+		h.currency.ConvertResponse(r.Context(), &combinedResponse, shipmentReq.Currency)
 	}
 
 	// Return response
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/currency"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/fakeshiphawk"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/fakeusps"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/middleware"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/services"
+)
+
+const quoteBody = `{"origin_zip":"10001","destination_zip":"90210","items":[{"weight":2,"length":10,"width":8,"height":6,"qty":1}]}`
+
+// newTestHandler returns a Handler quoting from a fake ShipHawk server
+// running scenario, with the direct USPS integration disabled.
+func newTestHandler(t *testing.T, scenario string) *Handler {
+	t.Helper()
+	handler, _ := newTestHandlerWithFake(t, scenario)
+	return handler
+}
+
+// newTestHandlerWithFake is newTestHandler that also returns the fake
+// ShipHawk server, with the carrier list loaded from it.
+func newTestHandlerWithFake(t *testing.T, scenario string) (*Handler, *fakeshiphawk.Server) {
+	t.Helper()
+	fixtures, err := fakeshiphawk.Scenario(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := fakeshiphawk.New(fixtures, "")
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cfg := config.Defaults()
+	cfg.ShipHawk.BaseURL = srv.URL
+	cfg.ShipHawk.APIKey = "test-key"
+	uspsService, err := services.NewUSPSService(context.Background(), cfg, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	carrierService := services.NewCarrierService(cfg, srv.Client())
+	if err := carrierService.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(
+		services.NewShipHawkService(cfg, srv.Client()),
+		uspsService,
+		carrierService,
+		currency.NewConverter(nil, 0),
+		0,
+	), fake
+}
+
+func TestGetRateQuotes(t *testing.T) {
+	tests := []struct {
+		name         string
+		scenario     string
+		body         string
+		timeout      time.Duration
+		wantStatus   int
+		wantRates    []string
+		wantCarriers []string // carrier codes of the errors; "" for a general error
+	}{
+		{
+			name:       "ok",
+			scenario:   "ok",
+			body:       quoteBody,
+			wantStatus: http.StatusOK,
+			wantRates:  []string{"rate_ups_ground", "rate_fedex_2day"},
+		},
+		{
+			name:         "unprocessable",
+			scenario:     "unprocessable",
+			body:         quoteBody,
+			wantStatus:   http.StatusOK,
+			wantRates:    []string{"rate_ups_ground"},
+			wantCarriers: []string{"fedex", "dhl_ecommerce"},
+		},
+		{
+			name:         "server error",
+			scenario:     "server_error",
+			body:         quoteBody,
+			wantStatus:   http.StatusOK,
+			wantCarriers: []string{""},
+		},
+		{
+			name:         "flaky first request",
+			scenario:     "flaky",
+			body:         quoteBody,
+			wantStatus:   http.StatusOK,
+			wantCarriers: []string{""},
+		},
+		{
+			name:         "malformed",
+			scenario:     "malformed",
+			body:         quoteBody,
+			wantStatus:   http.StatusOK,
+			wantCarriers: []string{""},
+		},
+		{
+			name:         "slow",
+			scenario:     "slow",
+			body:         quoteBody,
+			timeout:      100 * time.Millisecond,
+			wantStatus:   http.StatusOK,
+			wantCarriers: []string{""},
+		},
+		{
+			name:       "invalid JSON",
+			scenario:   "ok",
+			body:       `{"items": [`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown extra service with USPS disabled",
+			scenario:   "ok",
+			body:       `{"destination_zip":"90210","items":[{"weight":2}],"extra_services":["teleport"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown weight unit",
+			scenario:   "ok",
+			body:       `{"destination_zip":"90210","items":[{"weight":2,"weight_uom":"stone"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTestHandler(t, tt.scenario)
+			req := httptest.NewRequest(http.MethodPost, "/api/quote", strings.NewReader(tt.body))
+			if tt.timeout > 0 {
+				ctx, cancel := context.WithTimeout(req.Context(), tt.timeout)
+				defer cancel()
+				req = req.WithContext(ctx)
+			}
+			rec := httptest.NewRecorder()
+			handler.GetRateQuotes(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp models.ShipHawkResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var rates, carriers []string
+			for _, r := range resp.Rates {
+				rates = append(rates, r.ID)
+				if r.TotalPrice == "" {
+					t.Errorf("rate %s has no total price", r.ID)
+				}
+			}
+			for _, e := range resp.Errors {
+				carriers = append(carriers, e.CarrierCode)
+			}
+			if !slices.Equal(rates, tt.wantRates) {
+				t.Errorf("rates = %v, want %v", rates, tt.wantRates)
+			}
+			if !slices.Equal(carriers, tt.wantCarriers) {
+				t.Errorf("error carriers = %v, want %v (%+v)", carriers, tt.wantCarriers, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestGetRateQuotesFlakyRecovers(t *testing.T) {
+	handler := newTestHandler(t, "flaky")
+	for i, wantRates := range []int{0, 2} {
+		rec := httptest.NewRecorder()
+		handler.GetRateQuotes(rec, httptest.NewRequest(http.MethodPost, "/api/quote", strings.NewReader(quoteBody)))
+		var resp models.ShipHawkResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Rates) != wantRates {
+			t.Errorf("request %d: got %d rates, want %d", i+1, len(resp.Rates), wantRates)
+		}
+	}
+}
+
+func TestGetRateQuotesQuoteTimeout(t *testing.T) {
+	fixtures, err := fakeshiphawk.Scenario("slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shipHawk := httptest.NewServer(fakeshiphawk.New(fixtures, ""))
+	t.Cleanup(shipHawk.Close)
+	uspsServer := httptest.NewServer(fakeusps.New(fakeusps.Default(), fakeusps.Credentials{}))
+	t.Cleanup(uspsServer.Close)
+
+	cfg := config.Defaults()
+	cfg.ShipHawk.BaseURL = shipHawk.URL
+	cfg.ShipHawk.APIKey = "test-key"
+	cfg.USPS.BaseURL = uspsServer.URL
+	cfg.USPS.ConsumerKey = "test-key"
+	cfg.USPS.ConsumerSecret = "test-secret"
+	uspsService, err := services.NewUSPSService(context.Background(), cfg, uspsServer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(
+		services.NewShipHawkService(cfg, shipHawk.Client()),
+		uspsService,
+		services.NewCarrierService(cfg, shipHawk.Client()),
+		currency.NewConverter(nil, 0),
+		500*time.Millisecond,
+	)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	handler.GetRateQuotes(rec, httptest.NewRequest(http.MethodPost, "/api/quote", strings.NewReader(quoteBody)))
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("quote took %s, want it cut off by the quote timeout", elapsed)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp models.ShipHawkResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var providers []string
+	for _, r := range resp.Rates {
+		if !slices.Contains(providers, r.RatesProvider) {
+			providers = append(providers, r.RatesProvider)
+		}
+	}
+	if !slices.Equal(providers, []string{"USPS"}) {
+		t.Errorf("rate providers = %v, want the USPS rates that finished in time", providers)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].CarrierName != "ShipHawk" {
+		t.Errorf("errors = %+v, want one for the ShipHawk call that timed out", resp.Errors)
+	}
+}
+
+func TestGetRateQuotesAccountNumberNeedsPrivateKey(t *testing.T) {
+	keys := []config.APIKey{
+		{Name: "storefront", Key: "store-key", Scopes: []string{"quote"}},
+		{Name: "web-ui", Key: "public-key", Scopes: []string{"quote"}, Public: true},
+	}
+	handler := middleware.NewAuth(keys, false).Require(middleware.ScopeQuote, http.HandlerFunc(newTestHandler(t, "ok").GetRateQuotes))
+	body := `{"destination_zip":"90210","items":[{"weight":2}],"usps":{"account_number":"1234567"}}`
+	tests := []struct {
+		key        string
+		wantStatus int
+	}{
+		{"store-key", http.StatusOK},
+		{"public-key", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/quote", strings.NewReader(body))
+			req.Header.Set("X-API-Key", tt.key)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestGetRateQuotesNarrowsCarriersForRestrictedDestinations(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantFilters [][]string // carrier_filter of each ShipHawk request
+		wantWarning string
+	}{
+		{
+			name:        "unrestricted",
+			body:        quoteBody,
+			wantFilters: [][]string{{}},
+		},
+		{
+			name:        "PO Box quotes every carrier that can deliver",
+			body:        `{"destination_address":{"street1":"PO Box 12","zip":"90210"},"items":[{"weight":2}]}`,
+			wantFilters: [][]string{{"ups", "fedex", "usps"}},
+		},
+		{
+			name:        "no carrier left",
+			body:        `{"destination_zip":"96910","carrier_filter":["dhl_ecommerce"],"items":[{"weight":2}]}`,
+			wantFilters: nil,
+			wantWarning: "dhl_ecommerce does not deliver to Guam",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, fake := newTestHandlerWithFake(t, "ok")
+			rec := httptest.NewRecorder()
+			handler.GetRateQuotes(rec, httptest.NewRequest(http.MethodPost, "/api/quote", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			var filters [][]string
+			for _, req := range fake.Requests() {
+				var body struct {
+					CarrierFilter []string `json:"carrier_filter"`
+				}
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					t.Fatal(err)
+				}
+				filters = append(filters, body.CarrierFilter)
+			}
+			if !slices.EqualFunc(filters, tt.wantFilters, slices.Equal) {
+				t.Errorf("ShipHawk carrier filters = %q, want %q", filters, tt.wantFilters)
+			}
+
+			var resp models.ShipHawkResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantWarning != "" && !slices.ContainsFunc(resp.Warnings, func(w models.ShipHawkError) bool { return w.Message == tt.wantWarning }) {
+				t.Errorf("warnings = %+v, want %q", resp.Warnings, tt.wantWarning)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
+)
+
+// State is the position of a circuit breaker.
+type State string
+
+const (
+	Closed   State = "closed"
+	Open     State = "open"
+	HalfOpen State = "half_open"
+)
+
+// Outcome is the result of a call made through the breaker.
+type Outcome int
+
+const (
+	// Success means the provider answered normally.
+	Success Outcome = iota
+	// Failure means the provider is unhealthy (transport error, 5xx, 429).
+	Failure
+	// Ignored calls say nothing about the provider, e.g. the caller gave up.
+	Ignored
+)
+
+// ErrOpen is returned by Allow while the breaker is open.
+var ErrOpen = errors.New("provider temporarily unavailable")
+
+// Settings controls when a breaker trips and how it recovers.
+type Settings struct {
+	// ConsecutiveFailures opens the breaker after this many failures in a row.
+	ConsecutiveFailures int
+	// ErrorRate opens the breaker when the failure ratio within Window
+	// reaches it, once at least MinRequests calls have been made.
+	ErrorRate   float64
+	MinRequests int
+	Window      time.Duration
+	// OpenTimeout is how long the breaker stays open before letting a
+	// single half-open probe through.
+	OpenTimeout time.Duration
+}
+
+// Status is a point-in-time view of a breaker for the admin endpoint.
+type Status struct {
+	Name                string    `json:"name"`
+	State               State     `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	WindowRequests      int       `json:"window_requests"`
+	WindowFailures      int       `json:"window_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitzero"`
+	RetryAt             time.Time `json:"retry_at,omitzero"`
+}
+
+// Breaker is a circuit breaker for one upstream provider.
+type Breaker struct {
+	name     string
+	settings Settings
+	now      func() time.Time // time.Now, swapped in tests
+
+	mu          sync.Mutex
+	state       State
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// New creates a closed breaker for the named provider.
+func New(name string, settings Settings) *Breaker {
+	b := &Breaker{name: name, settings: settings, state: Closed, now: time.Now}
+	b.windowStart = b.now()
+	b.report()
+	return b
+}
+
+// Allow reports whether a call may proceed. On success the caller must pass
+// the call's outcome to done exactly once. While open, Allow returns an error
+// wrapping ErrOpen.
+func (b *Breaker) Allow() (done func(Outcome), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		retryAt := b.openedAt.Add(b.settings.OpenTimeout)
+		if b.now().Before(retryAt) {
+			return nil, fmt.Errorf("%s %w (circuit open until %s)", b.name, ErrOpen, retryAt.Format(time.TimeOnly))
+		}
+		b.setState(HalfOpen)
+		fallthrough
+	case HalfOpen:
+		// Only one probe at a time; everyone else keeps failing fast.
+		if b.probing {
+			return nil, fmt.Errorf("%s %w (circuit half-open, probing)", b.name, ErrOpen)
+		}
+		b.probing = true
+		return b.doneFunc(true), nil
+	}
+	return b.doneFunc(false), nil
+}
+
+func (b *Breaker) doneFunc(probe bool) func(Outcome) {
+	var once sync.Once
+	return func(outcome Outcome) {
+		once.Do(func() { b.record(outcome, probe) })
+	}
+}
+
+func (b *Breaker) record(outcome Outcome, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	if outcome == Ignored {
+		return
+	}
+
+	now := b.now()
+	if b.settings.Window > 0 && now.Sub(b.windowStart) > b.settings.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+
+	if outcome == Success {
+		b.consecutive = 0
+		if probe {
+			b.setState(Closed)
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		return
+	}
+
+	b.failures++
+	b.consecutive++
+	if probe || b.tripped() {
+		b.openedAt = now
+		b.setState(Open)
+	}
+}
+
+// tripped reports whether the closed-state thresholds have been crossed.
+func (b *Breaker) tripped() bool {
+	if b.state != Closed {
+		return false
+	}
+	if b.settings.ConsecutiveFailures > 0 && b.consecutive >= b.settings.ConsecutiveFailures {
+		return true
+	}
+	return b.settings.ErrorRate > 0 && b.requests >= b.settings.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.settings.ErrorRate
+}
+
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.report()
+}
+
+func (b *Breaker) report() {
+	values := map[State]float64{Closed: 0, HalfOpen: 1, Open: 2}
+	metrics.BreakerState.WithLabelValues(b.name).Set(values[b.state])
+}
+
+// Status returns the breaker's current state and counters.
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := Status{
+		Name:                b.name,
+		State:               b.state,
+		ConsecutiveFailures: b.consecutive,
+		WindowRequests:      b.requests,
+		WindowFailures:      b.failures,
+	}
+	if b.state != Closed {
+		status.OpenedAt = b.openedAt
+		status.RetryAt = b.openedAt.Add(b.settings.OpenTimeout)
+	}
+	return status
+}
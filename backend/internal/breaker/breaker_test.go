@@ -0,0 +1,139 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// clock is a manually advanced time source.
+type clock struct{ t time.Time }
+
+func (c *clock) Now() time.Time          { return c.t }
+func (c *clock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(settings Settings) (*Breaker, *clock) {
+	c := &clock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := New("test", settings)
+	b.now = c.Now
+	b.windowStart = c.Now()
+	return b, c
+}
+
+// call runs one call through the breaker with the given outcome and
+// reports whether the breaker let it through.
+func call(t *testing.T, b *Breaker, outcome Outcome) bool {
+	t.Helper()
+	done, err := b.Allow()
+	if err != nil {
+		if !errors.Is(err, ErrOpen) {
+			t.Fatalf("Allow() error = %v, want ErrOpen", err)
+		}
+		return false
+	}
+	done(outcome)
+	return true
+}
+
+func TestBreakerTripsOnConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(Settings{ConsecutiveFailures: 3, OpenTimeout: time.Minute})
+	call(t, b, Failure)
+	call(t, b, Failure)
+	call(t, b, Success) // resets the run
+	call(t, b, Failure)
+	call(t, b, Failure)
+	if got := b.Status().State; got != Closed {
+		t.Fatalf("state = %s after two failures in a row, want closed", got)
+	}
+	call(t, b, Failure)
+	if got := b.Status().State; got != Open {
+		t.Fatalf("state = %s after three failures in a row, want open", got)
+	}
+	if call(t, b, Success) {
+		t.Error("Allow() let a call through an open breaker")
+	}
+}
+
+func TestBreakerTripsOnErrorRate(t *testing.T) {
+	b, clk := newTestBreaker(Settings{ErrorRate: 0.5, MinRequests: 4, Window: time.Minute, OpenTimeout: time.Minute})
+
+	// Half the calls fail, but there aren't enough of them yet
+	call(t, b, Failure)
+	call(t, b, Success)
+	call(t, b, Failure)
+	if got := b.Status().State; got != Closed {
+		t.Fatalf("state = %s below min requests, want closed", got)
+	}
+
+	// A new window forgets the earlier failures
+	clk.Advance(2 * time.Minute)
+	call(t, b, Success)
+	call(t, b, Success)
+	call(t, b, Failure)
+	if got := b.Status().State; got != Closed {
+		t.Fatalf("state = %s at 1/3 failures in the new window, want closed", got)
+	}
+	call(t, b, Failure)
+	if got := b.Status().State; got != Open {
+		t.Errorf("state = %s at 2/4 failures, want open", got)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	tests := []struct {
+		name      string
+		outcome   Outcome
+		wantState State
+	}{
+		{"successful probe closes", Success, Closed},
+		{"failed probe reopens", Failure, Open},
+		{"ignored probe lets another through", Ignored, HalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, clk := newTestBreaker(Settings{ConsecutiveFailures: 1, OpenTimeout: 30 * time.Second})
+			call(t, b, Failure)
+
+			clk.Advance(29 * time.Second)
+			if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+				t.Fatalf("Allow() error = %v before the open timeout, want ErrOpen", err)
+			}
+
+			clk.Advance(time.Second)
+			probe, err := b.Allow()
+			if err != nil {
+				t.Fatalf("Allow() error = %v after the open timeout, want a probe", err)
+			}
+			if got := b.Status().State; got != HalfOpen {
+				t.Fatalf("state = %s while probing, want half_open", got)
+			}
+			if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+				t.Fatalf("Allow() error = %v during the probe, want only one probe", err)
+			}
+
+			probe(tt.outcome)
+			probe(Failure) // only the first outcome counts
+			status := b.Status()
+			if status.State != tt.wantState {
+				t.Fatalf("state = %s after the probe, want %s", status.State, tt.wantState)
+			}
+			switch tt.wantState {
+			case Closed:
+				if status.WindowRequests != 0 || status.WindowFailures != 0 {
+					t.Errorf("window = %d/%d, want it reset on closing", status.WindowFailures, status.WindowRequests)
+				}
+				if !call(t, b, Success) {
+					t.Error("Allow() refused a call after closing")
+				}
+			case Open:
+				if !status.RetryAt.Equal(clk.Now().Add(30 * time.Second)) {
+					t.Errorf("retry at = %s, want a fresh open timeout", status.RetryAt)
+				}
+			case HalfOpen:
+				if _, err := b.Allow(); err != nil {
+					t.Errorf("Allow() error = %v, want the next probe", err)
+				}
+			}
+		})
+	}
+}
@@ -1,50 +1,554 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
+// Profiles lists the named configuration profiles a config file may define.
+var Profiles = []string{"dev", "staging", "prod"}
+
 // Config holds all configuration values
 type Config struct {
-	ShipHawkAPIKey  string
-	ShipHawkBaseURL string
-	Port            string
+	Profile    string               `yaml:"profile"`
+	Server     ServerConfig         `yaml:"server"`
+	ShipHawk   ShipHawkConfig       `yaml:"shiphawk"`
+	USPS       USPSConfig           `yaml:"usps"`
+	Auth       AuthConfig           `yaml:"auth"`
+	RateLimits map[string]RateLimit `yaml:"rate_limits"`
+	CORS       CORSConfig           `yaml:"cors"`
+	HTTPClient HTTPClientConfig     `yaml:"http_client"`
+	Retry      RetryConfig          `yaml:"retry"`
+	Breaker    BreakerConfig        `yaml:"circuit_breaker"`
+	Cassette   CassetteConfig       `yaml:"cassette"`
+	Currency   CurrencyConfig       `yaml:"currency"`
+
+	// problems collects values that failed to parse while loading, so
+	// Validate can report them together with everything else.
+	problems []error
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port                string        `yaml:"port"`
+	ReadTimeout         time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout   time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout        time.Duration `yaml:"write_timeout"`
+	QuoteTimeout        time.Duration `yaml:"quote_timeout"`
+	IdleTimeout         time.Duration `yaml:"idle_timeout"`
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period"`
+	HealthCheckTTL      time.Duration `yaml:"health_check_ttl"`
+
+	// TrustedProxies are CIDRs or IPs whose X-Forwarded-For is honored
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// ShipHawkConfig holds ShipHawk API settings
+type ShipHawkConfig struct {
+	APIKey  string `yaml:"api_key"`
+	BaseURL string `yaml:"base_url"`
+}
+
+// USPSConfig holds settings for the direct USPS integration, which is
+// enabled when both consumer credentials are set. MailClasses, PriceType,
+// AccountType and AccountNumber are the pricing defaults; a quote request
+// may override them.
+type USPSConfig struct {
+	ConsumerKey    string   `yaml:"consumer_key"`
+	ConsumerSecret string   `yaml:"consumer_secret"`
+	BaseURL        string   `yaml:"base_url"`
+	MailClasses    []string `yaml:"mail_classes"`
+	PriceType      string   `yaml:"price_type"`
+	AccountType    string   `yaml:"account_type"`
+	AccountNumber  string   `yaml:"account_number"`
+}
+
+// Enabled reports whether USPS credentials are configured.
+func (c USPSConfig) Enabled() bool {
+	return c.ConsumerKey != "" && c.ConsumerSecret != ""
+}
+
+// AuthConfig holds API key authentication settings. Keys may be listed
+// inline and/or in a separate JSON keys file.
+type AuthConfig struct {
+	Disabled bool     `yaml:"disabled"`
+	KeysFile string   `yaml:"keys_file"`
+	Keys     []APIKey `yaml:"keys"`
+}
+
+// APIKey is a named client credential and the scopes it grants. Public
+// marks a key that is not secret, such as the one built into the frontend
+// bundle (VITE_API_KEY); it may only grant PublicScopes.
+type APIKey struct {
+	Name   string   `json:"name" yaml:"name"`
+	Key    string   `json:"key" yaml:"key"`
+	Scopes []string `json:"scopes" yaml:"scopes"`
+	Public bool     `json:"public,omitempty" yaml:"public,omitempty"`
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
+// RateLimit is a per-client token-bucket limit. Limit is a count per unit
+// such as "60/m" (units s, m, h); "0" disables limiting.
+type RateLimit struct {
+	Limit string `yaml:"limit"`
+	Burst int    `yaml:"burst"`
+}
+
+// PerSecond returns the bucket refill rate. It is zero for a disabled or
+// unparseable limit; Validate reports the latter.
+func (l RateLimit) PerSecond() float64 {
+	rate, _ := l.parse()
+	return rate
+}
+
+func (l RateLimit) parse() (float64, error) {
+	if l.Limit == "" || l.Limit == "0" {
+		return 0, nil
+	}
+	count, unit, ok := strings.Cut(l.Limit, "/")
+	n, err := strconv.ParseFloat(count, 64)
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if !ok || err != nil || n <= 0 || per == 0 {
+		return 0, fmt.Errorf("limit %q must look like 60/m (units s, m, h)", l.Limit)
+	}
+	return n / per.Seconds(), nil
+}
+
+// CORSConfig controls which browser origins may call the API. Origins are
+// exact ("https://shop.example.com") or wildcard subdomains
+// ("https://*.example.com"). An empty list allows no cross-origin calls.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+// HTTPClientConfig tunes the shared client used for ShipHawk and USPS.
+// Timeout bounds a whole request including retries. An empty Proxy falls
+// back to the HTTPS_PROXY/HTTP_PROXY environment variables.
+type HTTPClientConfig struct {
+	Timeout               time.Duration `yaml:"timeout"`
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+	MaxIdleConns          int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int           `yaml:"max_conns_per_host"`
+	HTTP2                 bool          `yaml:"http2"`
+	Proxy                 string        `yaml:"proxy"`
+	UserAgent             string        `yaml:"user_agent"`
+}
+
+// RetryConfig controls retries of failed ShipHawk and USPS requests.
+// MaxAttempts includes the first try; Budget caps the total time spent
+// across attempts; waits back off exponentially from BaseDelay to MaxDelay
+// with jitter.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"`
+	Budget      time.Duration `yaml:"budget"`
+	BaseDelay   time.Duration `yaml:"base_delay"`
+	MaxDelay    time.Duration `yaml:"max_delay"`
+}
+
+// BreakerConfig controls the per-provider circuit breakers. A breaker opens
+// after ConsecutiveFailures failures in a row, or when at least MinRequests
+// calls within Window fail at ErrorRate or more, and probes again after
+// OpenTimeout.
+type BreakerConfig struct {
+	ConsecutiveFailures int           `yaml:"consecutive_failures"`
+	ErrorRate           float64       `yaml:"error_rate"`
+	MinRequests         int           `yaml:"min_requests"`
+	Window              time.Duration `yaml:"window"`
+	OpenTimeout         time.Duration `yaml:"open_timeout"`
+}
+
+// CassetteConfig turns on recording of every ShipHawk and USPS exchange to
+// Dir ("record"), or answering upstream calls from those recordings without
+// touching the network ("replay"). Mode "off" calls the providers normally.
+type CassetteConfig struct {
+	Mode string `yaml:"mode"`
+	Dir  string `yaml:"dir"`
+}
+
+// CurrencyConfig picks where exchange rates for quoting in a requested
+// display currency come from: a JSON rate table on disk ("static"), a URL
+// serving the same table ("http"), or nowhere ("off"), which quotes only
+// in the providers' currency. Fetched rates are cached for CacheTTL.
+type CurrencyConfig struct {
+	Source   string        `yaml:"source"`
+	File     string        `yaml:"file"`
+	URL      string        `yaml:"url"`
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+// Options selects where configuration is read from.
+type Options struct {
+	// Path is the YAML config file. Empty means $GOSHIPHAWK_CONFIG, then
+	// config.yaml if it exists; running without a file is allowed.
+	Path string
+	// Profile picks a section under "profiles:" in the file. Empty means
+	// $GOSHIPHAWK_PROFILE, then the file's "profile:" key, then "dev".
+	Profile string
+}
+
+// Defaults returns the built-in configuration that the file, profile and
+// environment are layered on top of.
+func Defaults() *Config {
+	return &Config{
+		Profile: "dev",
+		Server: ServerConfig{
+			Port:                "8080",
+			ReadTimeout:         15 * time.Second,
+			ReadHeaderTimeout:   5 * time.Second,
+			WriteTimeout:        60 * time.Second,
+			QuoteTimeout:        45 * time.Second,
+			IdleTimeout:         120 * time.Second,
+			ShutdownGracePeriod: 30 * time.Second,
+			HealthCheckTTL:      30 * time.Second,
+			TrustedProxies:      []string{"127.0.0.1/32", "::1/128"},
+		},
+		ShipHawk: ShipHawkConfig{
+			BaseURL: "https://api.shiphawk.com",
+		},
+		USPS: USPSConfig{
+			BaseURL: "https://apis.usps.com",
+			MailClasses: []string{
+				"PRIORITY_MAIL", "USPS_GROUND_ADVANTAGE", "PRIORITY_MAIL_EXPRESS",
+				"PRIORITY_MAIL_INTERNATIONAL", "FIRST-CLASS_PACKAGE_INTERNATIONAL_SERVICE", "PRIORITY_MAIL_EXPRESS_INTERNATIONAL",
+			},
+			PriceType:   "COMMERCIAL",
+			AccountType: "EPS",
+		},
+		RateLimits: map[string]RateLimit{
+			"ip":       {Limit: "300/m", Burst: 50},
+			"quote":    {Limit: "60/m", Burst: 10},
+			"carriers": {Limit: "120/m", Burst: 20},
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
+			MaxAge:         10 * time.Minute,
+		},
+		HTTPClient: HTTPClientConfig{
+			Timeout:               30 * time.Second,
+			DialTimeout:           5 * time.Second,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 20 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+			MaxConnsPerHost:       50,
+			HTTP2:                 true,
+			UserAgent:             "GoShiphawkRates/1.0",
+		},
+		Retry: RetryConfig{
+			MaxAttempts: 3,
+			Budget:      10 * time.Second,
+			BaseDelay:   200 * time.Millisecond,
+			MaxDelay:    2 * time.Second,
+		},
+		Breaker: BreakerConfig{
+			ConsecutiveFailures: 5,
+			ErrorRate:           0.5,
+			MinRequests:         20,
+			Window:              time.Minute,
+			OpenTimeout:         30 * time.Second,
+		},
+		Cassette: CassetteConfig{
+			Mode: "off",
+			Dir:  "cassettes",
+		},
+		Currency: CurrencyConfig{
+			Source:   "off",
+			CacheTTL: time.Hour,
+		},
+	}
+}
+
+// Load builds the configuration from, in increasing precedence: built-in
+// defaults, the config file, the selected profile within it, and
+// environment variables (including a .env file). It only fails if the file
+// can't be read or parsed; call Validate to check the result.
+func Load(opts Options) (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
-	config := &Config{
-		ShipHawkAPIKey:  os.Getenv("SHIPHAWK_API_KEY"),
-		ShipHawkBaseURL: os.Getenv("SHIPHAWK_BASE_URL"),
-		Port:            os.Getenv("PORT"),
-	}
+	config := Defaults()
 
-	if config.ShipHawkAPIKey == "" {
-		return nil, ErrMissingAPIKey
+	path := firstNonEmpty(opts.Path, os.Getenv("GOSHIPHAWK_CONFIG"))
+	required := path != ""
+	if path == "" {
+		path = "config.yaml"
 	}
 
-	// Set default values
-	if config.ShipHawkBaseURL == "" {
-		config.ShipHawkBaseURL = "https://api.shiphawk.com"
+	var profiles map[string]yaml.Node
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var file struct {
+			Config   `yaml:",inline"`
+			Profiles map[string]yaml.Node `yaml:"profiles"`
+		}
+		file.Config = *config
+		problems, err := decodeStrict(data, &file, path, true)
+		if err != nil {
+			return nil, err
+		}
+		*config = file.Config
+		config.problems = append(config.problems, problems...)
+		profiles = file.Profiles
+	case required || !errors.Is(err, os.ErrNotExist):
+		return nil, &ConfigError{fmt.Sprintf("failed to read config file: %v", err)}
 	}
 
-	if config.Port == "" {
-		config.Port = "8080"
+	config.Profile = firstNonEmpty(opts.Profile, os.Getenv("GOSHIPHAWK_PROFILE"), config.Profile)
+	if node, ok := profiles[config.Profile]; ok {
+		// Decoding over the existing struct only replaces keys the profile
+		// sets. Nodes can't be decoded strictly, so go back through YAML.
+		profileData, err := yaml.Marshal(&node)
+		if err != nil {
+			return nil, &ConfigError{fmt.Sprintf("failed to parse profile %q in %s: %v", config.Profile, path, err)}
+		}
+		problems, err := decodeStrict(profileData, config, fmt.Sprintf("profile %q in %s", config.Profile, path), false)
+		if err != nil {
+			return nil, err
+		}
+		config.problems = append(config.problems, problems...)
 	}
 
+	config.applyEnv()
+	config.loadKeysFile()
+
 	return config, nil
 }
 
-// ErrMissingAPIKey Errors
+// yamlTypeError and unknownField pick apart yaml.TypeError messages such
+// as "line 3: field ratelimits not found in type config.Config".
 var (
-	ErrMissingAPIKey = &ConfigError{"SHIPHAWK_API_KEY environment variable is required"}
+	yamlTypeError = regexp.MustCompile(`^(?:line (\d+): )?(.*)$`)
+	unknownField  = regexp.MustCompile(`^field (\S+) not found in type`)
 )
 
+// decodeStrict decodes YAML into out, rejecting keys that match no field.
+// Unknown and mistyped keys are returned as problems for Validate to
+// report alongside everything else; only a syntax error fails outright.
+// Line numbers are dropped unless lines says they match the file.
+func decodeStrict(data []byte, out any, source string, lines bool) ([]error, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(out)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil, errors.Is(err, io.EOF):
+		return nil, nil
+	case errors.As(err, &typeErr):
+		var problems []error
+		for _, e := range typeErr.Errors {
+			m := yamlTypeError.FindStringSubmatch(e)
+			line, msg := m[1], m[2]
+			if unknown := unknownField.FindStringSubmatch(msg); unknown != nil {
+				msg = fmt.Sprintf("unknown key %q", unknown[1])
+			}
+			if lines && line != "" {
+				msg = "line " + line + ": " + msg
+			}
+			problems = append(problems, &ConfigError{fmt.Sprintf("%s: %s", source, msg)})
+		}
+		return problems, nil
+	default:
+		return nil, &ConfigError{fmt.Sprintf("failed to parse %s: %v", source, err)}
+	}
+}
+
+// applyEnv overrides file values with any environment variables that are set.
+func (c *Config) applyEnv() {
+	strs := []struct {
+		dst  *string
+		name string
+	}{
+		{&c.Server.Port, "PORT"},
+		{&c.ShipHawk.APIKey, "SHIPHAWK_API_KEY"},
+		{&c.ShipHawk.BaseURL, "SHIPHAWK_BASE_URL"},
+		{&c.USPS.ConsumerKey, "USPS_CONSUMER_KEY"},
+		{&c.USPS.ConsumerSecret, "USPS_CONSUMER_SECRET"},
+		{&c.USPS.BaseURL, "USPS_BASE_URL"},
+		{&c.USPS.PriceType, "USPS_PRICE_TYPE"},
+		{&c.USPS.AccountType, "USPS_ACCOUNT_TYPE"},
+		{&c.USPS.AccountNumber, "USPS_ACCOUNT_NUMBER"},
+		{&c.Auth.KeysFile, "API_KEYS_FILE"},
+		{&c.HTTPClient.Proxy, "UPSTREAM_PROXY"},
+		{&c.HTTPClient.UserAgent, "UPSTREAM_USER_AGENT"},
+		{&c.Cassette.Mode, "CASSETTE_MODE"},
+		{&c.Cassette.Dir, "CASSETTE_DIR"},
+		{&c.Currency.Source, "CURRENCY_SOURCE"},
+		{&c.Currency.File, "CURRENCY_RATES_FILE"},
+		{&c.Currency.URL, "CURRENCY_RATES_URL"},
+	}
+	for _, s := range strs {
+		if v := os.Getenv(s.name); v != "" {
+			*s.dst = v
+		}
+	}
+
+	durations := []struct {
+		dst  *time.Duration
+		name string
+	}{
+		{&c.Server.HealthCheckTTL, "HEALTH_CHECK_TTL"},
+		{&c.Server.ReadTimeout, "SERVER_READ_TIMEOUT"},
+		{&c.Server.ReadHeaderTimeout, "SERVER_READ_HEADER_TIMEOUT"},
+		{&c.Server.WriteTimeout, "SERVER_WRITE_TIMEOUT"},
+		{&c.Server.QuoteTimeout, "SERVER_QUOTE_TIMEOUT"},
+		{&c.Server.IdleTimeout, "SERVER_IDLE_TIMEOUT"},
+		{&c.Server.ShutdownGracePeriod, "SHUTDOWN_GRACE_PERIOD"},
+		{&c.CORS.MaxAge, "CORS_MAX_AGE"},
+		{&c.Retry.Budget, "RETRY_BUDGET"},
+		{&c.HTTPClient.Timeout, "UPSTREAM_TIMEOUT"},
+		{&c.Currency.CacheTTL, "CURRENCY_CACHE_TTL"},
+	}
+	for _, d := range durations {
+		v := os.Getenv(d.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			c.problemf("%s must be a duration such as 30s: %v", d.name, err)
+			continue
+		}
+		*d.dst = parsed
+	}
+
+	bools := []struct {
+		dst  *bool
+		name string
+	}{
+		{&c.Auth.Disabled, "AUTH_DISABLED"},
+		{&c.CORS.AllowCredentials, "CORS_ALLOW_CREDENTIALS"},
+	}
+	for _, b := range bools {
+		v := os.Getenv(b.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			c.problemf("%s must be true or false", b.name)
+			continue
+		}
+		*b.dst = parsed
+	}
+
+	lists := []struct {
+		dst  *[]string
+		name string
+	}{
+		{&c.Server.TrustedProxies, "TRUSTED_PROXIES"},
+		{&c.CORS.AllowedOrigins, "CORS_ALLOWED_ORIGINS"},
+		{&c.CORS.AllowedMethods, "CORS_ALLOWED_METHODS"},
+		{&c.CORS.AllowedHeaders, "CORS_ALLOWED_HEADERS"},
+		{&c.USPS.MailClasses, "USPS_MAIL_CLASSES"},
+	}
+	for _, l := range lists {
+		if v := os.Getenv(l.name); v != "" {
+			*l.dst = splitList(v)
+		}
+	}
+
+	if v := os.Getenv("RETRY_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil {
+			c.problemf("RETRY_MAX_ATTEMPTS must be an integer")
+		} else {
+			c.Retry.MaxAttempts = attempts
+		}
+	}
+
+	for route, limit := range c.RateLimits {
+		env := "RATE_LIMIT_" + strings.ToUpper(route)
+		if v := os.Getenv(env); v != "" {
+			limit.Limit = v
+		}
+		if v := os.Getenv(env + "_BURST"); v != "" {
+			burst, err := strconv.Atoi(v)
+			if err != nil {
+				c.problemf("%s_BURST must be an integer", env)
+			} else {
+				limit.Burst = burst
+			}
+		}
+		c.RateLimits[route] = limit
+	}
+
+	// API_KEYS holds "name:key:scope|scope,name:key:scope" entries, added to
+	// any keys from the file.
+	for i, entry := range splitList(os.Getenv("API_KEYS")) {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			c.problemf("API_KEYS entry %d must be name:key:scopes", i+1)
+			continue
+		}
+		c.Auth.Keys = append(c.Auth.Keys, APIKey{Name: parts[0], Key: parts[1], Scopes: strings.Split(parts[2], "|")})
+	}
+}
+
+// loadKeysFile appends keys from Auth.KeysFile, a JSON list of
+// {"name", "key", "scopes"} objects.
+func (c *Config) loadKeysFile() {
+	if c.Auth.KeysFile == "" {
+		return
+	}
+	data, err := os.ReadFile(c.Auth.KeysFile)
+	if err != nil {
+		c.problemf("failed to read auth.keys_file: %v", err)
+		return
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		c.problemf("failed to parse auth.keys_file: %v", err)
+		return
+	}
+	c.Auth.Keys = append(c.Auth.Keys, keys...)
+}
+
+func (c *Config) problemf(format string, args ...any) {
+	c.problems = append(c.problems, &ConfigError{fmt.Sprintf(format, args...)})
+}
+
+// splitList splits a comma-separated value, trimming spaces and dropping
+// empty entries.
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 type ConfigError struct {
 	message string
 }
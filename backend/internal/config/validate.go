@@ -0,0 +1,249 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CassetteModes lists the accepted cassette.mode values.
+var CassetteModes = []string{"off", "record", "replay"}
+
+// CurrencySources lists the accepted currency.source values.
+var CurrencySources = []string{"off", "static", "http"}
+
+// Scopes lists the permissions an API key can be granted. "admin" implies
+// all of the others.
+var Scopes = []string{"quote", "carriers", "ship", "admin"}
+
+// PublicScopes are the only scopes a public API key may grant.
+var PublicScopes = []string{"quote", "carriers"}
+
+// redacted replaces secret values in dumped configuration.
+const redacted = "REDACTED"
+
+// Validate checks the whole configuration and returns every problem found,
+// joined into one error, or nil if the configuration is usable.
+func (c *Config) Validate() error {
+	problems := slices.Clone(c.problems)
+	add := func(format string, args ...any) {
+		problems = append(problems, &ConfigError{fmt.Sprintf(format, args...)})
+	}
+
+	if !slices.Contains(Profiles, c.Profile) {
+		add("profile %q must be one of %s", c.Profile, strings.Join(Profiles, ", "))
+	}
+
+	if c.Server.Port == "" {
+		add("server.port is required")
+	}
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.quote_timeout", c.Server.QuoteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_grace_period", c.Server.ShutdownGracePeriod},
+		{"server.health_check_ttl", c.Server.HealthCheckTTL},
+		{"cors.max_age", c.CORS.MaxAge},
+		{"retry.budget", c.Retry.Budget},
+		{"retry.base_delay", c.Retry.BaseDelay},
+		{"retry.max_delay", c.Retry.MaxDelay},
+		{"http_client.timeout", c.HTTPClient.Timeout},
+		{"http_client.dial_timeout", c.HTTPClient.DialTimeout},
+		{"http_client.tls_handshake_timeout", c.HTTPClient.TLSHandshakeTimeout},
+		{"http_client.response_header_timeout", c.HTTPClient.ResponseHeaderTimeout},
+		{"http_client.idle_conn_timeout", c.HTTPClient.IdleConnTimeout},
+		{"circuit_breaker.window", c.Breaker.Window},
+		{"circuit_breaker.open_timeout", c.Breaker.OpenTimeout},
+	}
+	for _, d := range durations {
+		if d.d < 0 {
+			add("%s must not be negative", d.name)
+		}
+	}
+	// Upstream calls can each take up to http_client.timeout; the quote
+	// deadline has to leave time to write what came back before the write
+	// timeout cuts the connection.
+	if c.Server.WriteTimeout > 0 && (c.Server.QuoteTimeout <= 0 || c.Server.QuoteTimeout >= c.Server.WriteTimeout) {
+		add("server.quote_timeout (%s) must be set and shorter than server.write_timeout (%s)", c.Server.QuoteTimeout, c.Server.WriteTimeout)
+	}
+	if _, err := c.Server.TrustedProxyPrefixes(); err != nil {
+		add("server.trusted_proxies: %v", err)
+	}
+
+	if c.ShipHawk.APIKey == "" {
+		add("shiphawk.api_key (SHIPHAWK_API_KEY) is required")
+	}
+	checkURL := func(name, value string) {
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			add("%s %q must be an absolute URL", name, value)
+		}
+	}
+	checkURL("shiphawk.base_url", c.ShipHawk.BaseURL)
+
+	if (c.USPS.ConsumerKey == "") != (c.USPS.ConsumerSecret == "") {
+		add("usps.consumer_key and usps.consumer_secret must be set together")
+	}
+	if c.USPS.Enabled() {
+		checkURL("usps.base_url", c.USPS.BaseURL)
+		if len(c.USPS.MailClasses) == 0 {
+			add("usps.mail_classes needs at least one mail class")
+		}
+	}
+
+	if c.Auth.Disabled && c.Profile == "prod" {
+		add("auth.disabled is not allowed in the prod profile")
+	}
+	if len(c.Auth.Keys) == 0 && !c.Auth.Disabled {
+		add("at least one API key is required (auth.keys, API_KEYS or API_KEYS_FILE); set AUTH_DISABLED=true to run without authentication")
+	}
+	seen := make(map[string]bool)
+	for i, k := range c.Auth.Keys {
+		if k.Name == "" || k.Key == "" {
+			add("auth key %d needs a name and a key", i+1)
+			continue
+		}
+		if seen[k.Name] {
+			add("duplicate API key name %q", k.Name)
+		}
+		seen[k.Name] = true
+		for _, scope := range k.Scopes {
+			if !slices.Contains(Scopes, scope) {
+				add("API key %q has unknown scope %q", k.Name, scope)
+			} else if k.Public && !slices.Contains(PublicScopes, scope) {
+				add("API key %q is public and cannot grant the %q scope", k.Name, scope)
+			}
+		}
+	}
+
+	for _, route := range slices.Sorted(maps.Keys(c.RateLimits)) {
+		limit := c.RateLimits[route]
+		if _, err := limit.parse(); err != nil {
+			add("rate_limits.%s: %v", route, err)
+		}
+		if limit.PerSecond() > 0 && limit.Burst < 1 {
+			add("rate_limits.%s: burst must be at least 1", route)
+		}
+	}
+
+	if c.HTTPClient.Proxy != "" {
+		checkURL("http_client.proxy", c.HTTPClient.Proxy)
+	}
+	if c.HTTPClient.MaxIdleConns < 0 || c.HTTPClient.MaxIdleConnsPerHost < 0 || c.HTTPClient.MaxConnsPerHost < 0 {
+		add("http_client connection limits must not be negative")
+	}
+
+	if c.Retry.MaxAttempts < 1 {
+		add("retry.max_attempts must be at least 1")
+	}
+	if c.Breaker.ErrorRate < 0 || c.Breaker.ErrorRate > 1 {
+		add("circuit_breaker.error_rate must be between 0 and 1")
+	}
+
+	if !slices.Contains(CassetteModes, c.Cassette.Mode) {
+		add("cassette.mode %q must be one of %s", c.Cassette.Mode, strings.Join(CassetteModes, ", "))
+	}
+	if c.Cassette.Mode != "off" && c.Cassette.Dir == "" {
+		add("cassette.dir is required when cassette.mode is %s", c.Cassette.Mode)
+	}
+	if c.Cassette.Mode == "replay" && c.Profile == "prod" {
+		add("cassette.mode replay is not allowed in the prod profile")
+	}
+
+	switch c.Currency.Source {
+	case "off":
+	case "static":
+		if c.Currency.File == "" {
+			add("currency.file is required when currency.source is static")
+		}
+	case "http":
+		checkURL("currency.url", c.Currency.URL)
+	default:
+		add("currency.source %q must be one of %s", c.Currency.Source, strings.Join(CurrencySources, ", "))
+	}
+	if c.Currency.Source != "off" && c.Currency.CacheTTL <= 0 {
+		add("currency.cache_ttl must be positive")
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" && c.CORS.AllowCredentials {
+			add("cors.allowed_origins cannot be * when cors.allow_credentials is true")
+		}
+		if origin != "*" && !strings.Contains(origin, "://") {
+			add("CORS origin %q must include a scheme, e.g. https://", origin)
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+// TrustedProxyPrefixes parses TrustedProxies, accepting CIDRs or bare IPs.
+func (s ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range s.TrustedProxies {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Redacted returns a copy of the configuration with secrets masked, safe to
+// print or log.
+func (c *Config) Redacted() *Config {
+	out := *c
+	mask := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return redacted
+	}
+	out.ShipHawk.APIKey = mask(c.ShipHawk.APIKey)
+	out.USPS.ConsumerSecret = mask(c.USPS.ConsumerSecret)
+	if u, err := url.Parse(c.HTTPClient.Proxy); err == nil {
+		out.HTTPClient.Proxy = u.Redacted()
+	}
+	// Exchange rate APIs usually take their key in the query string
+	if u, err := url.Parse(c.Currency.URL); err == nil && u.RawQuery != "" {
+		u.RawQuery = redacted
+		out.Currency.URL = u.String()
+	}
+	out.Auth.Keys = make([]APIKey, len(c.Auth.Keys))
+	for i, k := range c.Auth.Keys {
+		k.Key = mask(k.Key)
+		out.Auth.Keys[i] = k
+	}
+	return &out
+}
+
+// Dump writes the configuration as YAML with secrets redacted.
+func (c *Config) Dump(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,346 @@
+// Package currency converts quoted prices into the display currency a
+// storefront asks for. Exchange rates come from a pluggable Source, a JSON
+// table on disk or served over HTTP, and are cached by a Converter.
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+)
+
+// ErrUnsupported is returned for a currency the rate table doesn't cover,
+// or any currency other than the providers' when conversion is off.
+var ErrUnsupported = errors.New("unsupported currency")
+
+// Table is a set of exchange rates: one unit of Base buys Rates[code] of
+// each other currency.
+type Table struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// rate returns how many units of code one unit of Base buys.
+func (t *Table) rate(code string) (float64, bool) {
+	if code == t.Base {
+		return 1, true
+	}
+	r, ok := t.Rates[code]
+	return r, ok && r > 0
+}
+
+// parseTable decodes and checks a JSON rate table.
+func parseTable(data []byte) (*Table, error) {
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse exchange rates: %w", err)
+	}
+	t.Base = strings.ToUpper(t.Base)
+	if t.Base == "" || len(t.Rates) == 0 {
+		return nil, fmt.Errorf("exchange rates need a base currency and at least one rate")
+	}
+	rates := make(map[string]float64, len(t.Rates))
+	for code, r := range t.Rates {
+		if r <= 0 {
+			return nil, fmt.Errorf("exchange rate for %s must be positive", code)
+		}
+		rates[strings.ToUpper(code)] = r
+	}
+	t.Rates = rates
+	return &t, nil
+}
+
+// Source supplies the current exchange rates.
+type Source interface {
+	Rates(ctx context.Context) (*Table, error)
+}
+
+// FileSource reads a rate table from a JSON file, re-read whenever the
+// Converter's cache expires.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Rates(ctx context.Context) (*Table, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+	return parseTable(data)
+}
+
+// HTTPSource fetches a rate table from URL.
+type HTTPSource struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s HTTPSource) Rates(ctx context.Context) (*Table, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rate source returned status code %d", resp.StatusCode)
+	}
+	return parseTable(body)
+}
+
+// NewSource returns the source cfg selects, or nil when conversion is off.
+func NewSource(cfg config.CurrencyConfig, client *http.Client) Source {
+	switch cfg.Source {
+	case "static":
+		return FileSource{Path: cfg.File}
+	case "http":
+		return HTTPSource{URL: cfg.URL, Client: client}
+	default:
+		return nil
+	}
+}
+
+// Converter converts amounts between currencies, fetching rates from its
+// source at most once per TTL. Expired rates keep being served while a
+// refresh runs in the background, and after it if the refresh fails.
+type Converter struct {
+	source Source
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	table    *Table
+	fetched  time.Time
+	inflight *refresh
+}
+
+// refresh is a fetch from the source that callers can wait on.
+type refresh struct {
+	done  chan struct{}
+	table *Table
+	err   error
+}
+
+// NewConverter creates a Converter. A nil source disables conversion.
+func NewConverter(source Source, ttl time.Duration) *Converter {
+	return &Converter{source: source, ttl: ttl}
+}
+
+// Enabled reports whether a rate source is configured.
+func (c *Converter) Enabled() bool {
+	return c.source != nil
+}
+
+// rates returns the cached table, refreshing it once it is older than ttl.
+// The source is never called with c.mu held: callers only wait for a fetch
+// when there is no table to serve yet, and share it when they do.
+func (c *Converter) rates(ctx context.Context) (*Table, error) {
+	c.mu.Lock()
+	if c.table != nil {
+		table := c.table
+		if time.Since(c.fetched) >= c.ttl && c.inflight == nil {
+			c.startRefresh(ctx)
+		}
+		c.mu.Unlock()
+		return table, nil
+	}
+	r := c.inflight
+	if r == nil {
+		r = c.startRefresh(ctx)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.table, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startRefresh fetches the rates in the background. It must be called with
+// c.mu held. The fetch outlives the request that started it, so a caller
+// giving up doesn't fail it for the others.
+func (c *Converter) startRefresh(ctx context.Context) *refresh {
+	r := &refresh{done: make(chan struct{})}
+	c.inflight = r
+	go c.refresh(context.WithoutCancel(ctx), r)
+	return r
+}
+
+func (c *Converter) refresh(ctx context.Context, r *refresh) {
+	table, err := c.source.Rates(ctx)
+
+	c.mu.Lock()
+	defer close(r.done)
+	defer c.mu.Unlock()
+	c.inflight = nil
+	if err != nil {
+		r.err = err
+		if c.table != nil {
+			// Stale rates beat failing every quote; try again after another ttl
+			log.Printf("Failed to refresh exchange rates, keeping rates from %s: %v", c.fetched.Format(time.RFC3339), err)
+			c.fetched = time.Now()
+		}
+		return
+	}
+	c.table, c.fetched = table, time.Now()
+	r.table = table
+}
+
+// Rate returns how many units of to one unit of from buys.
+func (c *Converter) Rate(ctx context.Context, from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return 1, nil
+	}
+	if !c.Enabled() {
+		return 0, fmt.Errorf("%w %s: currency conversion is not configured", ErrUnsupported, to)
+	}
+	table, err := c.rates(ctx)
+	if err != nil {
+		return 0, err
+	}
+	fromRate, ok := table.rate(from)
+	if !ok {
+		return 0, fmt.Errorf("%w %s", ErrUnsupported, from)
+	}
+	toRate, ok := table.rate(to)
+	if !ok {
+		return 0, fmt.Errorf("%w %s", ErrUnsupported, to)
+	}
+	return toRate / fromRate, nil
+}
+
+// Check reports ErrUnsupported if code can't be converted to from the
+// providers' currency, USD. Failing to fetch rates isn't reported here:
+// quotes then stay in USD with a warning.
+func (c *Converter) Check(ctx context.Context, code string) error {
+	if len(code) != 3 {
+		return fmt.Errorf("%w %q: use a three-letter ISO 4217 code", ErrUnsupported, code)
+	}
+	_, err := c.Rate(ctx, "USD", code)
+	if errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// ConvertResponse converts every rate in resp to currency, keeping each
+// rate's original price and currency and the exchange rate used. Rates
+// that can't be converted are left as they are, with a warning.
+func (c *Converter) ConvertResponse(ctx context.Context, resp *models.ShipHawkResponse, currency string) {
+	currency = strings.ToUpper(currency)
+	warned := make(map[string]bool)
+	for i := range resp.Rates {
+		rate := &resp.Rates[i]
+		from := strings.ToUpper(rate.CurrencyCode)
+		if from == "" {
+			from = "USD"
+		}
+		if from == currency {
+			continue
+		}
+		exchangeRate, err := c.Rate(ctx, from, currency)
+		if err != nil {
+			if !warned[from] {
+				warned[from] = true
+				resp.Warnings = append(resp.Warnings, models.ShipHawkError{
+					Message: fmt.Sprintf("Prices are in %s: %v", from, err),
+				})
+			}
+			continue
+		}
+		convertRate(rate, from, currency, exchangeRate)
+	}
+}
+
+// convertRate converts every amount on a rate by exchangeRate. Components
+// are converted and rounded to the cent first, then Price, TotalPrice and
+// LandedCost are summed from them so a rate still adds up; whatever a
+// provider's total holds beyond its components is converted as one more
+// amount.
+func convertRate(rate *models.Rate, from, to string, exchangeRate float64) {
+	rate.OriginalPrice = rate.Price
+	rate.OriginalCurrency = from
+	rate.ExchangeRate = math.Round(exchangeRate*1e6) / 1e6
+	rate.CurrencyCode = to
+
+	amount := func(v float64) float64 {
+		return math.Round(v*exchangeRate*100) / 100
+	}
+	parse := func(s string) (float64, bool) {
+		v, err := strconv.ParseFloat(s, 64)
+		return v, err == nil
+	}
+	format := func(v float64) string {
+		return fmt.Sprintf("%.2f", v)
+	}
+
+	var surcharges, convertedSurcharges float64
+	for i := range rate.Surcharges {
+		v := float64(rate.Surcharges[i].Amount)
+		c := amount(v)
+		rate.Surcharges[i].Amount = models.Amount(c)
+		surcharges += v
+		convertedSurcharges += c
+	}
+	var extras, convertedExtras float64
+	for i := range rate.ExtraServices {
+		v := rate.ExtraServices[i].Price
+		c := amount(v)
+		rate.ExtraServices[i].Price = c
+		extras += v
+		convertedExtras += c
+	}
+	duties, taxes := float64(rate.Duties), float64(rate.Taxes)
+	rate.Duties = models.Amount(amount(duties))
+	rate.Taxes = models.Amount(amount(taxes))
+	rate.InsurancePrice = amount(rate.InsurancePrice)
+
+	price, priceOK := parse(rate.Price)
+	total, totalOK := parse(rate.TotalPrice)
+	landed, landedOK := parse(rate.LandedCost)
+	converted := amount(price)
+	if base, ok := parse(rate.BasePrice); ok {
+		rate.BasePrice = format(amount(base))
+		converted = amount(base) + convertedSurcharges + amount(price-base-surcharges)
+	}
+	if !priceOK {
+		// Without a price there is nothing to sum the totals from
+		if totalOK {
+			rate.TotalPrice = format(amount(total))
+		}
+		if landedOK {
+			rate.LandedCost = format(amount(landed))
+		}
+		return
+	}
+	rate.Price = format(converted)
+	if totalOK {
+		rate.TotalPrice = format(converted + convertedExtras + amount(total-price-extras))
+	}
+	if landedOK {
+		rate.LandedCost = format(converted + float64(rate.Duties+rate.Taxes) + amount(landed-price-duties-taxes))
+	}
+}
@@ -0,0 +1,324 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+)
+
+// countingSource serves table, or err once set, counting fetches. Fetches
+// wait for release when it is set.
+type countingSource struct {
+	table   *Table
+	err     error
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *countingSource) Rates(ctx context.Context) (*Table, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	if s.release != nil {
+		<-s.release
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.table, nil
+}
+
+func (s *countingSource) fetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func testTable() *Table {
+	return &Table{Base: "USD", Rates: map[string]float64{"CAD": 1.3712, "EUR": 0.9184}}
+}
+
+// expire makes the converter's cached table older than its TTL.
+func expire(c *Converter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetched = c.fetched.Add(-2 * c.ttl)
+}
+
+// settle waits for a background refresh, if one is running, to finish.
+func settle(c *Converter) {
+	c.mu.Lock()
+	r := c.inflight
+	c.mu.Unlock()
+	if r != nil {
+		<-r.done
+	}
+}
+
+func TestConverterCachesRates(t *testing.T) {
+	source := &countingSource{table: testTable()}
+	c := NewConverter(source, time.Hour)
+	ctx := context.Background()
+	for range 3 {
+		if _, err := c.Rate(ctx, "USD", "CAD"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := source.fetches(); got != 1 {
+		t.Errorf("source fetched %d times within the TTL, want 1", got)
+	}
+
+	expire(c)
+	if _, err := c.Rate(ctx, "USD", "CAD"); err != nil {
+		t.Fatal(err)
+	}
+	settle(c)
+	if got := source.fetches(); got != 2 {
+		t.Errorf("source fetched %d times after the TTL, want 2", got)
+	}
+}
+
+func TestConverterServesStaleRatesWhileRefreshing(t *testing.T) {
+	source := &countingSource{table: testTable()}
+	c := NewConverter(source, time.Hour)
+	ctx := context.Background()
+	if _, err := c.Rate(ctx, "USD", "CAD"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The refresh hangs; callers get the expired rates meanwhile
+	source.release = make(chan struct{})
+	source.table = &Table{Base: "USD", Rates: map[string]float64{"CAD": 1.4}}
+	expire(c)
+	for range 3 {
+		done := make(chan float64)
+		go func() {
+			rate, _ := c.Rate(ctx, "USD", "CAD")
+			done <- rate
+		}()
+		select {
+		case got := <-done:
+			if got != 1.3712 {
+				t.Errorf("Rate() = %v during the refresh, want the stale 1.3712", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Rate() blocked behind the refresh")
+		}
+	}
+
+	close(source.release)
+	settle(c)
+	if got, _ := c.Rate(ctx, "USD", "CAD"); got != 1.4 {
+		t.Errorf("Rate() = %v after the refresh, want 1.4", got)
+	}
+	if got := source.fetches(); got != 2 {
+		t.Errorf("source fetched %d times, want one refresh shared by every caller", got)
+	}
+}
+
+func TestConverterSharesFirstFetch(t *testing.T) {
+	source := &countingSource{table: testTable(), release: make(chan struct{})}
+	c := NewConverter(source, time.Hour)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			if _, err := c.Rate(context.Background(), "USD", "CAD"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	// A caller that gives up doesn't wait for, or cancel, the fetch
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Rate(ctx, "USD", "CAD"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Rate() error = %v, want the caller's deadline", err)
+	}
+
+	close(source.release)
+	wg.Wait()
+	if got := source.fetches(); got != 1 {
+		t.Errorf("source fetched %d times, want the first fetch shared", got)
+	}
+}
+
+func TestConverterKeepsStaleRatesOnError(t *testing.T) {
+	source := &countingSource{table: testTable()}
+	c := NewConverter(source, time.Hour)
+	ctx := context.Background()
+	if _, err := c.Rate(ctx, "USD", "CAD"); err != nil {
+		t.Fatal(err)
+	}
+
+	source.err = errors.New("rate source down")
+	expire(c)
+	if _, err := c.Rate(ctx, "USD", "CAD"); err != nil {
+		t.Fatal(err)
+	}
+	settle(c)
+	got, err := c.Rate(ctx, "USD", "CAD")
+	if err != nil {
+		t.Fatalf("Rate() error = %v, want the stale rate", err)
+	}
+	if got != 1.3712 {
+		t.Errorf("Rate() = %v, want the stale 1.3712", got)
+	}
+	settle(c)
+	if got := source.fetches(); got != 2 {
+		t.Errorf("source fetched %d times, want the failed refresh to wait another TTL", got)
+	}
+}
+
+func TestConverterFailsWithoutRates(t *testing.T) {
+	source := &countingSource{err: errors.New("rate source down")}
+	c := NewConverter(source, time.Hour)
+	if _, err := c.Rate(context.Background(), "USD", "CAD"); err == nil {
+		t.Error("Rate() error = nil, want the source's error")
+	}
+}
+
+func TestConverterRate(t *testing.T) {
+	c := NewConverter(&countingSource{table: testTable()}, time.Hour)
+	tests := []struct {
+		from, to string
+		want     float64
+	}{
+		{"USD", "USD", 1},
+		{"usd", "cad", 1.3712},
+		{"CAD", "USD", 1 / 1.3712},
+		{"CAD", "EUR", 0.9184 / 1.3712},
+		{"EUR", "CAD", 1.3712 / 0.9184},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"-"+tt.to, func(t *testing.T) {
+			got, err := c.Rate(context.Background(), tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Rate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConverterCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    Source
+		code      string
+		unsupport bool
+	}{
+		{"known", &countingSource{table: testTable()}, "EUR", false},
+		{"providers' currency", &countingSource{table: testTable()}, "USD", false},
+		{"unknown", &countingSource{table: testTable()}, "JPY", true},
+		{"not a code", &countingSource{table: testTable()}, "EURO", true},
+		{"source down", &countingSource{err: errors.New("down")}, "EUR", false},
+		{"conversion off", nil, "EUR", true},
+		{"conversion off, providers' currency", nil, "USD", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewConverter(tt.source, time.Hour).Check(context.Background(), tt.code)
+			if got := errors.Is(err, ErrUnsupported); got != tt.unsupport {
+				t.Errorf("Check(%q) = %v, want unsupported %v", tt.code, err, tt.unsupport)
+			}
+		})
+	}
+}
+
+// cents parses a price to whole cents.
+func cents(t *testing.T, price string) int {
+	t.Helper()
+	v, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		t.Fatalf("price %q: %v", price, err)
+	}
+	return int(math.Round(v * 100))
+}
+
+func TestConvertResponseKeepsComponentsSummed(t *testing.T) {
+	// 1.23 USD is 1.69 CAD, but 2.46 USD is 3.37 CAD rather than 3.38
+	resp := &models.ShipHawkResponse{Rates: []models.Rate{{
+		ID:         "usps",
+		Price:      "2.46",
+		BasePrice:  "1.23",
+		TotalPrice: "4.92",
+		Surcharges: []models.Surcharge{{Code: models.SurchargeNonstandard, Amount: 1.23}},
+		ExtraServices: []models.ExtraServicePrice{
+			{Service: models.ExtraSignature, Price: 1.23},
+			{Service: models.ExtraInsurance, Price: 1.23},
+		},
+		InsurancePrice: 1.23,
+	}, {
+		ID:         "fedex",
+		Price:      "71.85",
+		BasePrice:  "62.69",
+		TotalPrice: "71.85",
+		Surcharges: []models.Surcharge{{Code: models.SurchargeFuel, Amount: 9.16}},
+		Duties:     14.25,
+		Taxes:      20.90,
+		LandedCost: "108.50",
+	}}}
+	NewConverter(&countingSource{table: testTable()}, time.Hour).ConvertResponse(context.Background(), resp, "cad")
+
+	for _, rate := range resp.Rates {
+		t.Run(rate.ID, func(t *testing.T) {
+			if rate.CurrencyCode != "CAD" || rate.OriginalCurrency != "USD" || rate.ExchangeRate != 1.3712 {
+				t.Errorf("currency = %s from %s at %v, want CAD from USD at 1.3712", rate.CurrencyCode, rate.OriginalCurrency, rate.ExchangeRate)
+			}
+			price := cents(t, rate.BasePrice)
+			for _, sc := range rate.Surcharges {
+				price += int(math.Round(float64(sc.Amount) * 100))
+			}
+			if got := cents(t, rate.Price); got != price {
+				t.Errorf("price = %s, want base price plus surcharges %.2f", rate.Price, float64(price)/100)
+			}
+			total := price
+			for _, extra := range rate.ExtraServices {
+				total += int(math.Round(extra.Price * 100))
+			}
+			if got := cents(t, rate.TotalPrice); got != total {
+				t.Errorf("total price = %s, want price plus extras %.2f", rate.TotalPrice, float64(total)/100)
+			}
+		})
+	}
+
+	// ShipHawk's landed cost is 1.50 more than price, duties and taxes;
+	// that difference is converted on its own
+	fedex := resp.Rates[1]
+	want := cents(t, fedex.Price) + int(math.Round(float64(fedex.Duties+fedex.Taxes)*100)) + 206
+	if got := cents(t, fedex.LandedCost); got != want {
+		t.Errorf("landed cost = %s, want %.2f", fedex.LandedCost, float64(want)/100)
+	}
+	if fedex.OriginalPrice != "71.85" {
+		t.Errorf("original price = %s, want 71.85", fedex.OriginalPrice)
+	}
+}
+
+func TestConvertResponseWarnsOnce(t *testing.T) {
+	resp := &models.ShipHawkResponse{Rates: []models.Rate{
+		{ID: "a", Price: "10.00", CurrencyCode: "JPY"},
+		{ID: "b", Price: "20.00", CurrencyCode: "JPY"},
+		{ID: "c", Price: "30.00"},
+	}}
+	NewConverter(&countingSource{table: testTable()}, time.Hour).ConvertResponse(context.Background(), resp, "EUR")
+
+	if len(resp.Warnings) != 1 {
+		t.Errorf("warnings = %v, want one for JPY", resp.Warnings)
+	}
+	if resp.Rates[0].Price != "10.00" || resp.Rates[0].CurrencyCode != "JPY" {
+		t.Errorf("JPY rate = %s %s, want it left as it was", resp.Rates[0].Price, resp.Rates[0].CurrencyCode)
+	}
+	if resp.Rates[2].Price != "27.55" || resp.Rates[2].CurrencyCode != "EUR" {
+		t.Errorf("USD rate = %s %s, want 27.55 EUR", resp.Rates[2].Price, resp.Rates[2].CurrencyCode)
+	}
+}
@@ -0,0 +1,243 @@
+// Package destination classifies where a shipment is going before it is
+// quoted: US territories, military APO/FPO/DPO addresses and PO Boxes all
+// restrict which carriers can deliver. Rates and errors from carriers and
+// services that can't serve the destination are dropped with a warning
+// explaining why.
+package destination
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+)
+
+// Classification describes the restrictions that apply to a destination.
+type Classification struct {
+	// Territory is the two-letter code of a US territory or freely
+	// associated state, empty for the states.
+	Territory string
+	// Military is set for APO/FPO/DPO addresses.
+	Military bool
+	// POBox is set when the street address is a PO Box.
+	POBox bool
+}
+
+// territoryNames names the territories and freely associated states that
+// USPS delivers to as domestic mail.
+var territoryNames = map[string]string{
+	"PR": "Puerto Rico",
+	"VI": "the US Virgin Islands",
+	"GU": "Guam",
+	"AS": "American Samoa",
+	"MP": "the Northern Mariana Islands",
+	"FM": "Micronesia",
+	"MH": "the Marshall Islands",
+	"PW": "Palau",
+}
+
+// uspsOnlyTerritories are served by USPS but not by the private carriers
+// we quote through ShipHawk. Puerto Rico and the Virgin Islands have UPS
+// and FedEx service.
+var uspsOnlyTerritories = []string{"GU", "AS", "MP", "FM", "MH", "PW"}
+
+// territoryZIPs maps ZIP code ranges, inclusive, to territories.
+var territoryZIPs = []struct {
+	from, to  int
+	territory string
+}{
+	{600, 799, "PR"},
+	{800, 899, "VI"},
+	{900, 999, "PR"},
+	{96799, 96799, "AS"},
+	{96910, 96932, "GU"},
+	{96939, 96940, "PW"},
+	{96941, 96944, "FM"},
+	{96950, 96952, "MP"},
+	{96960, 96960, "MH"},
+	{96970, 96970, "MH"},
+}
+
+// militaryStates are the pseudo-state codes for Armed Forces Americas,
+// Europe and Pacific.
+var militaryStates = []string{"AA", "AE", "AP"}
+
+// militaryCities are the city names used on military addresses.
+var militaryCities = []string{"APO", "FPO", "DPO"}
+
+// militaryZIPs are ZIP code ranges, inclusive, reserved for military mail.
+var militaryZIPs = []struct{ from, to int }{
+	{9000, 9899},   // AE
+	{34000, 34099}, // AA
+	{96200, 96699}, // AP
+}
+
+// poBoxPattern matches "PO Box 12", "P.O. Box", "Post Office Box" and "POB 12".
+var poBoxPattern = regexp.MustCompile(`(?i)\b(p\.?\s*o\.?\s*box|post\s+office\s+box|pob\s+\d)`)
+
+// Classify inspects a quote request's destination ZIP, state, city, country
+// and street lines.
+func Classify(req *models.ShipmentRequest) Classification {
+	var c Classification
+	addr := req.DestinationAddress
+	if addr == nil {
+		addr = &models.Address{}
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(req.DestinationCountry()))
+	if _, ok := territoryNames[country]; ok {
+		c.Territory = country
+	} else if country != "" && country != "US" && country != "USA" {
+		// International destinations are quoted as such
+		return c
+	}
+
+	state := strings.ToUpper(strings.TrimSpace(addr.State))
+	city := strings.ToUpper(strings.TrimSpace(addr.City))
+	zip := zip5(req.DestinationPostalCode())
+
+	if _, ok := territoryNames[state]; ok && c.Territory == "" {
+		c.Territory = state
+	}
+	if c.Territory == "" && zip >= 0 {
+		for _, r := range territoryZIPs {
+			if zip >= r.from && zip <= r.to {
+				c.Territory = r.territory
+				break
+			}
+		}
+	}
+
+	c.Military = slices.Contains(militaryStates, state) || slices.Contains(militaryCities, city)
+	if !c.Military && zip >= 0 {
+		for _, r := range militaryZIPs {
+			if zip >= r.from && zip <= r.to {
+				c.Military = true
+				break
+			}
+		}
+	}
+
+	c.POBox = poBoxPattern.MatchString(addr.Street1) || poBoxPattern.MatchString(addr.Street2)
+	return c
+}
+
+// zip5 parses the first five digits of a ZIP code, or returns -1.
+func zip5(zip string) int {
+	zip = strings.TrimSpace(zip)
+	if len(zip) < 5 {
+		return -1
+	}
+	n, err := strconv.Atoi(zip[:5])
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Restricted reports whether anything about the destination limits which
+// carriers can deliver.
+func (c Classification) Restricted() bool {
+	return c.Military || c.POBox || slices.Contains(uspsOnlyTerritories, c.Territory)
+}
+
+// uspsDeliveredServices are private carrier services handed to USPS for
+// final delivery, so they reach PO Boxes and APO/FPO/DPO addresses too.
+var uspsDeliveredServices = []string{"smartpost", "ground economy", "surepost", "mail innovations"}
+
+// uspsDeliveringCarriers offer one of uspsDeliveredServices: FedEx Ground
+// Economy (formerly SmartPost), UPS SurePost and UPS Mail Innovations.
+var uspsDeliveringCarriers = []string{"fedex", "ups"}
+
+// Excludes reports whether a carrier's service can't deliver to the
+// destination, and why. Only USPS, and services USPS delivers the last mile
+// of, reach APO/FPO/DPO addresses, PO Boxes and the Pacific territories.
+// An empty service stands for all of the carrier's services.
+func (c Classification) Excludes(carrierCode, service string) (string, bool) {
+	if strings.EqualFold(carrierCode, "usps") {
+		return "", false
+	}
+	service = strings.ToLower(service)
+	uspsDelivered := service != "" && slices.ContainsFunc(uspsDeliveredServices, func(s string) bool {
+		return strings.Contains(service, s)
+	})
+	switch {
+	case c.Military && !uspsDelivered:
+		return "does not deliver to APO/FPO/DPO addresses", true
+	case c.POBox && !uspsDelivered:
+		return "does not deliver to PO Boxes", true
+	case slices.Contains(uspsOnlyTerritories, c.Territory) && !uspsDelivered:
+		return "does not deliver to " + territoryNames[c.Territory], true
+	}
+	return "", false
+}
+
+// Carriers narrows the carriers a quote would ask ShipHawk for to those
+// with at least one service that can reach the destination, so a
+// restricted destination doesn't pay for quotes Filter would drop. It
+// returns the codes to quote and a warning for each carrier left out.
+func (c Classification) Carriers(carriers []models.Carrier) ([]string, []models.ShipHawkError) {
+	var codes []string
+	var warnings []models.ShipHawkError
+	for _, carrier := range carriers {
+		reason, excluded := c.Excludes(carrier.Code, "")
+		if excluded && !slices.Contains(uspsDeliveringCarriers, strings.ToLower(carrier.Code)) {
+			warnings = append(warnings, models.ShipHawkError{
+				Message:     fmt.Sprintf("%s %s", cmp.Or(carrier.Name, carrier.Code), reason),
+				CarrierName: carrier.Name,
+				CarrierCode: carrier.Code,
+			})
+			continue
+		}
+		codes = append(codes, carrier.Code)
+	}
+	return codes, warnings
+}
+
+// Filter drops rates and errors from carriers and services that can't serve
+// the destination, adding a warning for each one excluded.
+func (c Classification) Filter(resp *models.ShipHawkResponse) {
+	if !c.Restricted() {
+		return
+	}
+	warned := make(map[string]bool)
+	exclude := func(carrierName, carrierCode, service string) bool {
+		reason, ok := c.Excludes(carrierCode, service)
+		if !ok {
+			return false
+		}
+		carrier := cmp.Or(carrierName, carrierCode)
+		key := strings.ToLower(carrierCode + "|" + service)
+		if !warned[key] {
+			warned[key] = true
+			message := fmt.Sprintf("%s %s", carrier, reason)
+			if service != "" {
+				message = fmt.Sprintf("%s excluded: %s", service, message)
+			}
+			resp.Warnings = append(resp.Warnings, models.ShipHawkError{
+				Message:     message,
+				CarrierName: carrierName,
+				CarrierCode: carrierCode,
+			})
+		}
+		return true
+	}
+
+	resp.Rates = slices.DeleteFunc(resp.Rates, func(rate models.Rate) bool {
+		return exclude(rate.Carrier, rate.CarrierCode, cmp.Or(rate.ServiceName, rate.RateDisplayName))
+	})
+	// A carrier-specific error from an excluded carrier is explained by the
+	// warning; errors without a carrier, such as ShipHawk being down, stay.
+	// So do errors from a carrier with services that still deliver here.
+	serving := make(map[string]bool)
+	for _, rate := range resp.Rates {
+		serving[strings.ToLower(rate.CarrierCode)] = true
+	}
+	resp.Errors = slices.DeleteFunc(resp.Errors, func(e models.ShipHawkError) bool {
+		return e.CarrierCode != "" && !serving[strings.ToLower(e.CarrierCode)] && exclude(e.CarrierName, e.CarrierCode, "")
+	})
+}
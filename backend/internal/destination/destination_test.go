@@ -0,0 +1,166 @@
+package destination
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name    string
+		zip     string
+		country string
+		addr    *models.Address
+		want    Classification
+	}{
+		{"state", "90210", "", nil, Classification{}},
+		{"Puerto Rico", "00901", "", nil, Classification{Territory: "PR"}},
+		{"Virgin Islands", "00802", "", nil, Classification{Territory: "VI"}},
+		{"Guam ZIP+4", "96910-1234", "", nil, Classification{Territory: "GU"}},
+		{"American Samoa", "96799", "", nil, Classification{Territory: "AS"}},
+		{"Marshall Islands", "96970", "", nil, Classification{Territory: "MH"}},
+		{"territory as country", "", "PW", nil, Classification{Territory: "PW"}},
+		{"territory as state", "", "", &models.Address{State: "mp"}, Classification{Territory: "MP"}},
+		{"foreign country", "96910", "CA", nil, Classification{}},
+		{"AE ZIP", "09012", "", nil, Classification{Military: true}},
+		{"AA ZIP", "34001", "", nil, Classification{Military: true}},
+		{"AP ZIP", "96201", "", nil, Classification{Military: true}},
+		{"military state", "", "", &models.Address{State: "AP"}, Classification{Military: true}},
+		{"military city", "", "", &models.Address{City: " fpo "}, Classification{Military: true}},
+		{"PO Box", "90210", "", &models.Address{Street1: "PO Box 12"}, Classification{POBox: true}},
+		{"P.O. Box", "90210", "", &models.Address{Street1: "P.O. Box 12"}, Classification{POBox: true}},
+		{"Post Office Box on line 2", "90210", "", &models.Address{Street1: "Unit 4", Street2: "post office box 9"}, Classification{POBox: true}},
+		{"POB", "90210", "", &models.Address{Street1: "POB 12"}, Classification{POBox: true}},
+		{"street named Box", "90210", "", &models.Address{Street1: "12 Boxwood Pobst Rd"}, Classification{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.ShipmentRequest{DestinationZip: tt.zip, DestinationCountryID: tt.country, DestinationAddress: tt.addr}
+			if got := Classify(req); got != tt.want {
+				t.Errorf("Classify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// quoted is a response with rates and errors from every kind of carrier.
+func quoted() *models.ShipHawkResponse {
+	return &models.ShipHawkResponse{
+		Rates: []models.Rate{
+			{ID: "usps", Carrier: "USPS", CarrierCode: "usps", ServiceName: "Priority Mail"},
+			{ID: "fedex_economy", Carrier: "FedEx", CarrierCode: "fedex", ServiceName: "FedEx Ground Economy"},
+			{ID: "fedex_ground", Carrier: "FedEx", CarrierCode: "fedex", ServiceName: "FedEx Ground"},
+			{ID: "ups_ground", Carrier: "UPS", CarrierCode: "ups", ServiceName: "UPS Ground"},
+		},
+		Errors: []models.ShipHawkError{
+			{Message: "FedEx 2Day unavailable", CarrierName: "FedEx", CarrierCode: "fedex"},
+			{Message: "DHL timed out", CarrierName: "DHL eCommerce", CarrierCode: "dhl_ecommerce"},
+			{Message: "ShipHawk is slow", CarrierName: "ShipHawk"},
+		},
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		dest         Classification
+		wantRates    []string
+		wantErrors   []string
+		wantWarnings []string
+	}{
+		{
+			name:       "unrestricted",
+			dest:       Classification{Territory: "PR"},
+			wantRates:  []string{"usps", "fedex_economy", "fedex_ground", "ups_ground"},
+			wantErrors: []string{"fedex", "dhl_ecommerce", ""},
+		},
+		{
+			name:       "military",
+			dest:       Classification{Military: true},
+			wantRates:  []string{"usps", "fedex_economy"},
+			wantErrors: []string{"fedex", ""},
+			wantWarnings: []string{
+				"FedEx Ground excluded: FedEx does not deliver to APO/FPO/DPO addresses",
+				"UPS Ground excluded: UPS does not deliver to APO/FPO/DPO addresses",
+				"DHL eCommerce does not deliver to APO/FPO/DPO addresses",
+			},
+		},
+		{
+			name:       "PO Box",
+			dest:       Classification{POBox: true},
+			wantRates:  []string{"usps", "fedex_economy"},
+			wantErrors: []string{"fedex", ""},
+			wantWarnings: []string{
+				"FedEx Ground excluded: FedEx does not deliver to PO Boxes",
+				"UPS Ground excluded: UPS does not deliver to PO Boxes",
+				"DHL eCommerce does not deliver to PO Boxes",
+			},
+		},
+		{
+			name:       "Guam",
+			dest:       Classification{Territory: "GU"},
+			wantRates:  []string{"usps", "fedex_economy"},
+			wantErrors: []string{"fedex", ""},
+			wantWarnings: []string{
+				"FedEx Ground excluded: FedEx does not deliver to Guam",
+				"UPS Ground excluded: UPS does not deliver to Guam",
+				"DHL eCommerce does not deliver to Guam",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := quoted()
+			tt.dest.Filter(resp)
+
+			var rates, errs, warnings []string
+			for _, r := range resp.Rates {
+				rates = append(rates, r.ID)
+			}
+			for _, e := range resp.Errors {
+				errs = append(errs, e.CarrierCode)
+			}
+			for _, w := range resp.Warnings {
+				warnings = append(warnings, w.Message)
+			}
+			if !slices.Equal(rates, tt.wantRates) {
+				t.Errorf("rates = %v, want %v", rates, tt.wantRates)
+			}
+			if !slices.Equal(errs, tt.wantErrors) {
+				t.Errorf("error carriers = %q, want %q", errs, tt.wantErrors)
+			}
+			if !slices.Equal(warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestCarriers(t *testing.T) {
+	carriers := []models.Carrier{
+		{Code: "ups", Name: "UPS"},
+		{Code: "fedex", Name: "FedEx"},
+		{Code: "usps", Name: "USPS"},
+		{Code: "dhl_ecommerce", Name: "DHL eCommerce"},
+		{Code: "ontrac"},
+	}
+	codes, warnings := Classification{POBox: true}.Carriers(carriers)
+	if want := []string{"ups", "fedex", "usps"}; !slices.Equal(codes, want) {
+		t.Errorf("codes = %v, want %v", codes, want)
+	}
+	var messages []string
+	for _, w := range warnings {
+		messages = append(messages, w.Message)
+	}
+	if got := strings.Join(messages, "; "); got != "DHL eCommerce does not deliver to PO Boxes; ontrac does not deliver to PO Boxes" {
+		t.Errorf("warnings = %q, want DHL eCommerce and ontrac left out", got)
+	}
+
+	codes, warnings = Classification{}.Carriers(carriers)
+	if len(codes) != len(carriers) || len(warnings) != 0 {
+		t.Errorf("codes, warnings = %v, %v, want every carrier kept for an unrestricted destination", codes, warnings)
+	}
+}
@@ -0,0 +1,66 @@
+// Package fakerates is a stand-in exchange rate API for the currency
+// package's HTTP source. Point CURRENCY_RATES_URL at its /rates endpoint to
+// quote in other currencies without an exchange rate provider account.
+package fakerates
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+//go:embed rates.json
+var defaultRates []byte
+
+// Default returns the built-in rate table.
+func Default() json.RawMessage {
+	return json.RawMessage(defaultRates)
+}
+
+// LoadRates reads a rate table file in the currency.Table JSON layout.
+func LoadRates(path string) (json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates: %w", err)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("failed to parse rates: %s is not valid JSON", path)
+	}
+	return data, nil
+}
+
+// Server is an http.Handler serving a rate table at GET /rates.
+type Server struct {
+	mu    sync.Mutex
+	rates json.RawMessage
+	mux   *http.ServeMux
+}
+
+// New creates a fake exchange rate server serving rates.
+func New(rates json.RawMessage) *Server {
+	s := &Server{rates: rates, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /rates", s.handleRates)
+	return s
+}
+
+// SetRates replaces the served rate table.
+func (s *Server) SetRates(rates json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rates = rates
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleRates(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	rates := s.rates
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(rates)
+}
@@ -0,0 +1,134 @@
+package fakeshiphawk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Fixture scripts a single response from the fake server.
+type Fixture struct {
+	// Status is the HTTP status code; zero means 200.
+	Status int `json:"status,omitempty"`
+	// Body is sent as JSON. RawBody, when set, is sent verbatim instead so
+	// fixtures can return malformed JSON.
+	Body    json.RawMessage `json:"body,omitempty"`
+	RawBody string          `json:"raw_body,omitempty"`
+	// Delay holds the response back, e.g. "3s", to exercise timeouts.
+	Delay   Duration          `json:"delay,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Fixtures is the full script for a fake server. Rates are served in order,
+// one per request, and the last one repeats once the list is exhausted.
+type Fixtures struct {
+	Rates    []Fixture `json:"rates"`
+	Carriers Fixture   `json:"carriers"`
+}
+
+// Duration is a time.Duration that reads from JSON as "250ms" or "3s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("delay must be a duration string such as \"2s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadFixtures reads a fixtures file in the Fixtures JSON layout.
+func LoadFixtures(path string) (Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Fixtures{}, fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+	if f.Carriers.Body == nil && f.Carriers.RawBody == "" {
+		f.Carriers = CarriersOK
+	}
+	return f, nil
+}
+
+// Canned responses for the built-in scenarios.
+var (
+	RatesOK = Fixture{Body: json.RawMessage(`{
+  "rates": [
+    {"id": "rate_ups_ground", "carrier": "UPS", "carrier_code": "ups", "service_name": "UPS Ground", "service_code": "03", "service_level": "Ground", "standardized_service_name": "Ground", "rate_display_name": "UPS Ground", "price": "12.34", "currency_code": "USD", "est_delivery_date": "2026-10-23", "est_delivery_time": null, "service_days": 4, "rates_provider": "ShipHawk", "insurance_price": 0, "surcharges": [{"code": "FSC", "description": "Fuel Surcharge", "amount": "1.71"}, {"code": "RES", "description": "Residential Surcharge", "amount": "5.55"}]},
+    {"id": "rate_fedex_2day", "carrier": "FedEx", "carrier_code": "fedex", "service_name": "FedEx 2Day", "service_code": "FEDEX_2_DAY", "service_level": "Two-Day", "standardized_service_name": "Two-Day", "rate_display_name": "FedEx 2Day", "price": "24.10", "currency_code": "USD", "est_delivery_date": "2026-10-21", "est_delivery_time": null, "service_days": 2, "rates_provider": "ShipHawk", "insurance_price": 0, "surcharges": [{"code": "FUEL", "description": "Fuel Surcharge", "amount": 3.25}, {"code": "DELIVERY_AREA", "description": "Delivery Area Surcharge", "amount": 3.95}]}
+  ]
+}`)}
+
+	RatesUnprocessable = Fixture{Status: 422, Body: json.RawMessage(`{
+  "rates": [
+    {"id": "rate_ups_ground", "carrier": "UPS", "carrier_code": "ups", "service_name": "UPS Ground", "service_code": "03", "service_level": "Ground", "standardized_service_name": "Ground", "rate_display_name": "UPS Ground", "price": "12.34", "currency_code": "USD", "est_delivery_date": "2026-10-23", "est_delivery_time": null, "service_days": 4, "rates_provider": "ShipHawk", "insurance_price": 0}
+  ],
+  "errors": [
+    {"message": "Destination postal code is invalid for this service", "carrier_name": "FedEx", "carrier_code": "fedex", "carrier_type": "fedex"},
+    {"message": "Package exceeds maximum weight", "carrier_name": "DHL eCommerce", "carrier_code": "dhl_ecommerce", "carrier_type": "dhl"}
+  ]
+}`)}
+
+	RatesInternational = Fixture{Body: json.RawMessage(`{
+  "rates": [
+    {"id": "rate_ups_worldwide_expedited", "carrier": "UPS", "carrier_code": "ups", "service_name": "UPS Worldwide Expedited", "service_code": "08", "service_level": "International", "standardized_service_name": "International Expedited", "rate_display_name": "UPS Worldwide Expedited", "price": "86.40", "currency_code": "USD", "est_delivery_date": "2026-10-26", "est_delivery_time": null, "service_days": 5, "rates_provider": "ShipHawk", "insurance_price": 0, "duties": "14.25", "taxes": 21.63, "surcharges": [{"code": "fuel", "description": "Fuel Surcharge", "amount": "11.02"}, {"code": "ddp", "description": "Duties Paid Fee", "amount": 7.50}], "quoted_value": "120.00", "incoterm": "DDP"},
+    {"id": "rate_fedex_intl_economy", "carrier": "FedEx", "carrier_code": "fedex", "service_name": "FedEx International Economy", "service_code": "INTERNATIONAL_ECONOMY", "service_level": "International", "standardized_service_name": "International Economy", "rate_display_name": "FedEx International Economy", "price": "71.85", "currency_code": "USD", "est_delivery_date": "2026-10-28", "est_delivery_time": null, "service_days": 7, "rates_provider": "ShipHawk", "insurance_price": 0, "duties": 14.25, "taxes": 20.90, "landed_cost": "108.50", "surcharges": [{"code": "FUEL", "description": "Fuel", "amount": 9.16}], "quoted_value": "120.00", "incoterm": "DDP"}
+  ]
+}`)}
+
+	RatesServerError = Fixture{Status: 502, RawBody: "<html><body>502 Bad Gateway</body></html>"}
+
+	RatesMalformed = Fixture{RawBody: `{"rates": [{"id": "rate_ups_ground", "price": 12.34,`}
+
+	RatesSlow = Fixture{Body: RatesOK.Body, Delay: Duration(5 * time.Second)}
+
+	CarriersOK = Fixture{Body: json.RawMessage(`[
+  {"code": "ups", "carrier_type": {"code": "ups"}, "name": "UPS", "is_enabled": true, "activatable": true, "required_credentials": [], "optional_credentials": [], "test_mode": true, "status": "active", "logo": ""},
+  {"code": "fedex", "carrier_type": {"code": "fedex"}, "name": "FedEx", "is_enabled": true, "activatable": true, "required_credentials": [], "optional_credentials": [], "test_mode": true, "status": "active", "logo": ""},
+  {"code": "usps", "carrier_type": {"code": "usps"}, "name": "USPS", "is_enabled": true, "activatable": true, "required_credentials": [], "optional_credentials": [], "test_mode": true, "status": "active", "logo": ""}
+]`)}
+)
+
+var scenarios = map[string]Fixtures{
+	"ok":            {Rates: []Fixture{RatesOK}, Carriers: CarriersOK},
+	"unprocessable": {Rates: []Fixture{RatesUnprocessable}, Carriers: CarriersOK},
+	"international": {Rates: []Fixture{RatesInternational}, Carriers: CarriersOK},
+	"server_error":  {Rates: []Fixture{RatesServerError}, Carriers: CarriersOK},
+	"flaky":         {Rates: []Fixture{RatesServerError, RatesOK}, Carriers: CarriersOK},
+	"malformed":     {Rates: []Fixture{RatesMalformed}, Carriers: CarriersOK},
+	"slow":          {Rates: []Fixture{RatesSlow}, Carriers: CarriersOK},
+}
+
+// Scenario returns the fixtures for a named built-in scenario.
+func Scenario(name string) (Fixtures, error) {
+	f, ok := scenarios[name]
+	if !ok {
+		return Fixtures{}, fmt.Errorf("unknown scenario %q (have %s)", name, strings.Join(ScenarioNames(), ", "))
+	}
+	return f, nil
+}
+
+// ScenarioNames lists the built-in scenarios.
+func ScenarioNames() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
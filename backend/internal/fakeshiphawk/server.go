@@ -0,0 +1,118 @@
+// Package fakeshiphawk is a scriptable stand-in for the ShipHawk API. It
+// serves /api/v4/rates and /api/v4/carriers from fixtures so the services
+// can be exercised offline, either in-process via httptest or as the
+// cmd/fakeshiphawk binary.
+package fakeshiphawk
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Request is a rates request received by the fake server.
+type Request struct {
+	APIKey string
+	Body   json.RawMessage
+}
+
+// Server is an http.Handler that mimics the ShipHawk endpoints we use.
+type Server struct {
+	mu       sync.Mutex
+	fixtures Fixtures
+	next     int
+	apiKey   string
+	requests []Request
+	mux      *http.ServeMux
+}
+
+// New creates a fake server with the given fixtures. When apiKey is
+// non-empty, requests with a different X-API-Key get 401.
+func New(fixtures Fixtures, apiKey string) *Server {
+	s := &Server{fixtures: fixtures, apiKey: apiKey, mux: http.NewServeMux()}
+	s.mux.HandleFunc("POST /api/v4/rates", s.handleRates)
+	s.mux.HandleFunc("GET /api/v4/carriers", s.handleCarriers)
+	return s
+}
+
+// SetFixtures replaces the script and restarts the rates sequence.
+func (s *Server) SetFixtures(fixtures Fixtures) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures = fixtures
+	s.next = 0
+}
+
+// Requests returns the rates requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.apiKey != "" && r.Header.Get("X-API-Key") != s.apiKey {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = io.WriteString(w, `{"error": "Invalid API key"}`)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleRates(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{APIKey: r.Header.Get("X-API-Key"), Body: body})
+	var fixture Fixture
+	if n := len(s.fixtures.Rates); n > 0 {
+		fixture = s.fixtures.Rates[min(s.next, n-1)]
+		s.next++
+	}
+	s.mu.Unlock()
+
+	serve(w, r, fixture)
+}
+
+func (s *Server) handleCarriers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	fixture := s.fixtures.Carriers
+	s.mu.Unlock()
+
+	serve(w, r, fixture)
+}
+
+// serve writes fixture as the response, after its delay unless the client
+// gives up first.
+func serve(w http.ResponseWriter, r *http.Request, fixture Fixture) {
+	if fixture.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(fixture.Delay)):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for k, v := range fixture.Headers {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	status := fixture.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+
+	body := []byte(fixture.RawBody)
+	if fixture.RawBody == "" {
+		body = fixture.Body
+	}
+	if _, err := w.Write(body); err != nil {
+		log.Printf("fakeshiphawk: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package fakeusps
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/usps"
+)
+
+// Fixtures scripts the rate search responses of the fake server.
+type Fixtures struct {
+	// RateOptions are returned by /prices/v3/total-rates/search, narrowed to
+	// the mail classes a request asks for. They use the USPS JSON layout.
+	RateOptions []usps.RateOption `json:"rateOptions"`
+	// InternationalRateOptions answer
+	// /international-prices/v3/total-rates/search the same way.
+	InternationalRateOptions []usps.RateOption `json:"internationalRateOptions"`
+	// Status, when non-zero and not 200, fails every rate search with this
+	// status and Error as the body.
+	Status int             `json:"status,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+//go:embed fixtures/default.json
+var defaultFixtures []byte
+
+// Default returns fixtures covering every mail class we quote, with
+// machinable and non-machinable rates, SP/PA single-piece, CP cubic and flat
+// rate indicators, NONE/NDC/DDU destination entry facility types, and the
+// three international mail classes.
+func Default() Fixtures {
+	var f Fixtures
+	if err := json.Unmarshal(defaultFixtures, &f); err != nil {
+		panic(fmt.Sprintf("fakeusps: invalid embedded fixtures: %v", err))
+	}
+	return f
+}
+
+// LoadFixtures reads fixtures from a JSON file in the same layout as
+// fixtures/default.json.
+func LoadFixtures(path string) (Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Fixtures{}, fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+	return f, nil
+}
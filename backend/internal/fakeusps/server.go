@@ -0,0 +1,230 @@
+// Package fakeusps is a stand-in for the USPS APIs used by the usps
+// package: the OAuth client-credentials token endpoint and the domestic and
+// international total-rates searches. Point USPS_BASE_URL at it (or use httptest) to run
+// USPSService end to end without real consumer keys.
+package fakeusps
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/usps"
+)
+
+// Credentials are the consumer key and secret the fake accepts. Empty
+// fields accept anything.
+type Credentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// Server is an http.Handler that mimics the USPS endpoints we use.
+type Server struct {
+	creds    Credentials
+	tokenTTL time.Duration
+
+	mu       sync.Mutex
+	fixtures Fixtures
+	tokens   map[string]time.Time
+	requests []json.RawMessage
+	mux      *http.ServeMux
+}
+
+// New creates a fake USPS server serving fixtures.
+func New(fixtures Fixtures, creds Credentials) *Server {
+	s := &Server{
+		creds:    creds,
+		tokenTTL: time.Hour,
+		fixtures: fixtures,
+		tokens:   make(map[string]time.Time),
+		mux:      http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /oauth2/v3/token", s.handleToken)
+	s.mux.HandleFunc("POST /prices/v3/total-rates/search", s.handleRates)
+	s.mux.HandleFunc("POST /international-prices/v3/total-rates/search", s.handleInternationalRates)
+	return s
+}
+
+// SetFixtures replaces the rate search script.
+func (s *Server) SetFixtures(fixtures Fixtures) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fixtures = fixtures
+}
+
+// Requests returns the raw rate search bodies received so far.
+func (s *Server) Requests() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]json.RawMessage(nil), s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	// clientcredentials sends credentials as basic auth, or in the form if
+	// the server rejects that.
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	if (s.creds.ClientID != "" && id != s.creds.ClientID) || (s.creds.ClientSecret != "" && secret != s.creds.ClientSecret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error":             "invalid_client",
+			"error_description": "Client authentication failed",
+		})
+		return
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(s.tokenTTL)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(s.tokenTTL.Seconds()),
+		"scope":        "prices",
+	})
+}
+
+// searchRequest holds the fields of a domestic or international rate
+// search that the fake filters and prices on.
+type searchRequest struct {
+	MailClasses   []usps.MailClass    `json:"mailClasses"`
+	PriceType     usps.PriceType      `json:"priceType"`
+	RateIndicator usps.RateIndicator  `json:"rateIndicator"`
+	ExtraServices []usps.ExtraService `json:"extraServices"`
+}
+
+func (s *Server) handleRates(w http.ResponseWriter, r *http.Request) {
+	s.search(w, r, func(f Fixtures) []usps.RateOption { return f.RateOptions })
+}
+
+func (s *Server) handleInternationalRates(w http.ResponseWriter, r *http.Request) {
+	s.search(w, r, func(f Fixtures) []usps.RateOption { return f.InternationalRateOptions })
+}
+
+// search answers a rate search from the rate options options picks out of
+// the current fixtures.
+func (s *Server) search(w http.ResponseWriter, r *http.Request, options func(Fixtures) []usps.RateOption) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	expiry, ok := s.tokens[token]
+	s.mu.Unlock()
+	if !ok || time.Now().After(expiry) {
+		writeJSON(w, http.StatusUnauthorized, uspsError("401", "Invalid or expired access token"))
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var req searchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, uspsError("400", "Malformed request body"))
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, body)
+	fixtures := s.fixtures
+	s.mu.Unlock()
+
+	if fixtures.Status != 0 && fixtures.Status != http.StatusOK {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(fixtures.Status)
+		_, _ = w.Write(fixtures.Error)
+		return
+	}
+
+	resp := usps.RateResponse{RateOptions: []usps.RateOption{}}
+	for _, option := range options(fixtures) {
+		if slices.ContainsFunc(option.Rates, func(rate usps.Rate) bool {
+			return (len(req.MailClasses) == 0 || slices.Contains(req.MailClasses, rate.MailClass)) &&
+				(req.RateIndicator == "" || rate.RateIndicator == req.RateIndicator)
+		}) {
+			option.ExtraServices = extraServices(option, req)
+			resp.RateOptions = append(resp.RateOptions, option)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// extraServicePrices are charged for requested extras the fixtures don't
+// price themselves.
+var extraServicePrices = map[usps.ExtraService]struct {
+	name  string
+	price float64
+}{
+	usps.SignatureConfirmation:            {"Signature Confirmation", 3.65},
+	usps.AdultSignatureRequired:           {"Adult Signature Required", 7.95},
+	usps.AdultSignatureRestrictedDelivery: {"Adult Signature Restricted Delivery", 8.15},
+	usps.InsuranceUpTo500:                 {"Insurance <= $500", 2.65},
+	usps.InsuranceOver500:                 {"Insurance > $500", 9.10},
+}
+
+// extraServices prices the extras req asks for, preferring the option's
+// fixture entries. Like USPS, only requested extras are returned.
+func extraServices(option usps.RateOption, req searchRequest) []usps.ExtraServiceOption {
+	extras := []usps.ExtraServiceOption{}
+	for _, code := range req.ExtraServices {
+		i := slices.IndexFunc(option.ExtraServices, func(e usps.ExtraServiceOption) bool { return e.Code() == code })
+		if i >= 0 {
+			extras = append(extras, option.ExtraServices[i])
+			continue
+		}
+		if p, ok := extraServicePrices[code]; ok {
+			extras = append(extras, usps.ExtraServiceOption{
+				ExtraService: strconv.Itoa(int(code)),
+				Name:         p.name,
+				PriceType:    string(req.PriceType),
+				Price:        p.price,
+				Warnings:     []usps.Warning{},
+			})
+		}
+	}
+	return extras
+}
+
+// uspsError builds an error body in the USPS APIs' layout.
+func uspsError(code, message string) map[string]any {
+	return map[string]any{
+		"apiVersion": "v3",
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+		},
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("fakeusps: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// State is the outcome of a dependency check.
+type State string
+
+const (
+	StateOK       State = "ok"
+	StateFailing  State = "failing"
+	StateDisabled State = "disabled"
+)
+
+// ErrDisabled may be returned by a CheckFunc to report that the dependency is
+// intentionally turned off. Disabled dependencies don't fail readiness.
+var ErrDisabled = errors.New("disabled")
+
+// CheckFunc probes a single dependency.
+type CheckFunc func(ctx context.Context) error
+
+// Result is the last known state of a dependency.
+type Result struct {
+	Name        string    `json:"name"`
+	State       State     `json:"state"`
+	Error       string    `json:"error,omitempty"`
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// Report is the combined readiness of all dependencies.
+type Report struct {
+	Ready  bool     `json:"ready"`
+	Checks []Result `json:"checks"`
+}
+
+type check struct {
+	name    string
+	ttl     time.Duration
+	timeout time.Duration
+	fn      CheckFunc
+
+	mu       sync.Mutex
+	last     Result
+	inflight *probe
+}
+
+// probe is one run of a check's CheckFunc; result is set before done closes.
+type probe struct {
+	done   chan struct{}
+	result Result
+}
+
+// run returns the cached result if it is younger than the check's TTL,
+// otherwise probes the dependency. Concurrent callers share one probe rather
+// than each hitting the upstream. The probe runs on its own context, so a
+// caller that gives up neither cancels it nor has its cancellation cached;
+// the caller just gets a failing result while the probe carries on.
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	if !c.last.LastChecked.IsZero() && time.Since(c.last.LastChecked) < c.ttl {
+		result := c.last
+		c.mu.Unlock()
+		return result
+	}
+	p := c.inflight
+	if p == nil {
+		p = &probe{done: make(chan struct{})}
+		c.inflight = p
+		go c.probe(context.WithoutCancel(ctx), p)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return p.result
+	case <-ctx.Done():
+		return Result{Name: c.name, State: StateFailing, Error: "check did not finish: " + ctx.Err().Error(), LastChecked: time.Now()}
+	}
+}
+
+// probe runs the CheckFunc within the check's timeout and caches its result,
+// unless the probe was canceled rather than answered.
+func (c *check) probe(ctx context.Context, p *probe) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	result := Result{Name: c.name, State: StateOK, LastChecked: time.Now()}
+	err := c.fn(ctx)
+	if err != nil {
+		if errors.Is(err, ErrDisabled) {
+			result.State = StateDisabled
+		} else {
+			result.State = StateFailing
+			result.Error = err.Error()
+		}
+	}
+
+	c.mu.Lock()
+	if !errors.Is(err, context.Canceled) {
+		c.last = result
+	}
+	c.inflight = nil
+	c.mu.Unlock()
+	p.result = result
+	close(p.done)
+}
+
+// Checker runs a set of dependency checks, caching each result for its TTL.
+type Checker struct {
+	timeout time.Duration
+	checks  []*check
+}
+
+// NewChecker creates a Checker whose probes, and callers' waits for them, are
+// each bounded by timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a dependency check. A zero ttl runs the check on every call,
+// which is appropriate for cheap in-process checks.
+func (c *Checker) Add(name string, ttl time.Duration, fn CheckFunc) {
+	c.checks = append(c.checks, &check{name: name, ttl: ttl, timeout: c.timeout, fn: fn})
+}
+
+// Check runs every registered check concurrently and reports overall readiness.
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = chk.run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Ready: true, Checks: results}
+	for _, r := range results {
+		if r.State == StateFailing {
+			report.Ready = false
+		}
+	}
+	return report
+}
@@ -0,0 +1,129 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckerCachesResults(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(time.Second)
+	c.Add("upstream", time.Hour, func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+	for range 3 {
+		if report := c.Check(context.Background()); !report.Ready {
+			t.Fatalf("report = %+v, want ready", report)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("probed %d times within the TTL, want 1", got)
+	}
+}
+
+func TestCheckerReport(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantState State
+		wantReady bool
+	}{
+		{"ok", nil, StateOK, true},
+		{"failing", errors.New("down"), StateFailing, false},
+		{"disabled", ErrDisabled, StateDisabled, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(time.Second)
+			c.Add("self", 0, func(ctx context.Context) error { return nil })
+			c.Add("upstream", time.Hour, func(ctx context.Context) error { return tt.err })
+			report := c.Check(context.Background())
+			if report.Ready != tt.wantReady {
+				t.Errorf("ready = %v, want %v", report.Ready, tt.wantReady)
+			}
+			if got := report.Checks[1].State; got != tt.wantState {
+				t.Errorf("state = %s, want %s", got, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestCheckerIgnoresCallerCancellation(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	var probeErr atomic.Value
+	c := NewChecker(time.Minute)
+	c.Add("upstream", time.Hour, func(ctx context.Context) error {
+		calls.Add(1)
+		<-release
+		if err := ctx.Err(); err != nil {
+			probeErr.Store(err)
+		}
+		return nil
+	})
+
+	// The caller gives up while the probe hangs
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if report := c.Check(ctx); report.Ready {
+		t.Fatalf("report = %+v, want not ready while the probe is unanswered", report)
+	}
+
+	// Other callers aren't blocked behind the hung probe either
+	done := make(chan struct{})
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		c.Check(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("second caller blocked behind the hung probe")
+	}
+
+	close(release)
+	if report := c.Check(context.Background()); !report.Ready {
+		t.Errorf("report = %+v, want the probe's own OK result, not the caller's cancellation", report)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("probed %d times, want callers to share one probe", got)
+	}
+	if err := probeErr.Load(); err != nil {
+		t.Errorf("probe context = %v, want it to outlive its callers", err)
+	}
+}
+
+func TestCheckerDoesNotCacheCanceledProbes(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(time.Second)
+	c.Add("upstream", time.Hour, func(ctx context.Context) error {
+		if calls.Add(1) == 1 {
+			return context.Canceled
+		}
+		return nil
+	})
+	if report := c.Check(context.Background()); report.Ready {
+		t.Fatalf("first report = %+v, want not ready", report)
+	}
+	if report := c.Check(context.Background()); !report.Ready {
+		t.Errorf("second report = %+v, want a fresh probe", report)
+	}
+}
+
+func TestCheckerProbeTimeout(t *testing.T) {
+	c := NewChecker(20 * time.Millisecond)
+	c.Add("upstream", time.Hour, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	report := c.Check(context.Background())
+	if report.Ready || report.Checks[0].State != StateFailing {
+		t.Errorf("report = %+v, want the timed-out probe failing", report)
+	}
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "goshiphawk"
+
+var (
+	// HTTPRequests counts requests served by the API, by mux route pattern.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// HTTPRequestDuration tracks how long the API takes to answer, by route.
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// UpstreamDuration tracks latency of calls to ShipHawk and USPS, including
+	// the USPS OAuth token endpoint.
+	UpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Upstream provider request latency, by provider and endpoint.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2, 4, 8, 15, 30},
+	}, []string{"provider", "endpoint"})
+
+	// UpstreamResponses counts upstream responses by HTTP status code. Transport
+	// failures are recorded with code "error".
+	UpstreamResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_responses_total",
+		Help:      "Upstream provider responses, by provider, endpoint and status code.",
+	}, []string{"provider", "endpoint", "code"})
+
+	// UpstreamAttempts records how many tries each upstream request took,
+	// including retries.
+	UpstreamAttempts = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_attempts",
+		Help:      "Attempts made per upstream request, including retries, by provider and endpoint.",
+		Buckets:   []float64{1, 2, 3, 4, 5},
+	}, []string{"provider", "endpoint"})
+
+	// UpstreamRates counts rates a provider quoted, per carrier. ShipHawk
+	// quotes every carrier in one request, so with UpstreamErrors this is how
+	// each carrier's share of a provider's traffic is seen.
+	UpstreamRates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_rates_total",
+		Help:      "Rates quoted by upstream providers, by provider and carrier code.",
+	}, []string{"provider", "carrier_code"})
+
+	// UpstreamErrors counts errors reported by a provider. ShipHawk reports
+	// errors per carrier; failures not tied to a carrier use an empty code.
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Errors returned by upstream providers, by provider and carrier code.",
+	}, []string{"provider", "carrier_code"})
+
+	// QuotesServed counts rates returned to API callers.
+	QuotesServed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quotes_served_total",
+		Help:      "Rates returned to callers, by provider and carrier code.",
+	}, []string{"provider", "carrier_code"})
+
+	// BreakerState is each provider's circuit breaker position:
+	// 0 closed, 1 half-open, 2 open.
+	BreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "Circuit breaker state by provider (0 closed, 1 half-open, 2 open).",
+	}, []string{"provider"})
+
+	// RateLimited counts requests rejected with 429 by the rate limiter.
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the per-client rate limiter, by route.",
+	}, []string{"route"})
+
+	// CarriersLoaded is the number of carriers CarrierService loaded from ShipHawk.
+	CarriersLoaded = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "carriers_loaded",
+		Help:      "Number of carriers loaded from ShipHawk.",
+	})
+)
+
+// Handler returns the /metrics handler in Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Transport wraps next so that every upstream request made through it is
+// recorded under the given provider, labelled by URL path.
+func Transport(provider string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		endpoint := req.URL.Path
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		UpstreamDuration.WithLabelValues(provider, endpoint).Observe(time.Since(start).Seconds())
+		if err != nil {
+			UpstreamResponses.WithLabelValues(provider, endpoint, "error").Inc()
+			return nil, err
+		}
+		UpstreamResponses.WithLabelValues(provider, endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
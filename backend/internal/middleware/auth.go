@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+)
+
+// Scope is a permission granted to an API key
+type Scope string
+
+const (
+	ScopeQuote    Scope = "quote"
+	ScopeCarriers Scope = "carriers"
+	ScopeShip     Scope = "ship"
+	ScopeAdmin    Scope = "admin"
+)
+
+type contextKey int
+
+const (
+	keyNameContextKey contextKey = iota
+	keyPublicContextKey
+)
+
+// KeyName returns the name of the API key that authenticated the request,
+// or "" if the request was not authenticated.
+func KeyName(ctx context.Context) string {
+	name, _ := ctx.Value(keyNameContextKey).(string)
+	return name
+}
+
+// KeyPublic reports whether the request was authenticated with a public
+// key, one that is shipped to browsers and so shared by every visitor.
+func KeyPublic(ctx context.Context) bool {
+	public, _ := ctx.Value(keyPublicContextKey).(bool)
+	return public
+}
+
+type apiKey struct {
+	name   string
+	digest [sha256.Size]byte
+	scopes []Scope
+	public bool
+}
+
+// Auth checks API keys and enforces per-route scopes
+type Auth struct {
+	keys     []apiKey
+	disabled bool
+}
+
+// NewAuth creates an Auth from the configured keys. When disabled is true,
+// every request is let through unauthenticated. Public keys only ever get
+// config.PublicScopes, whatever else they list.
+func NewAuth(keys []config.APIKey, disabled bool) *Auth {
+	a := &Auth{disabled: disabled}
+	for _, k := range keys {
+		key := apiKey{name: k.Name, digest: sha256.Sum256([]byte(k.Key)), public: k.Public}
+		for _, s := range k.Scopes {
+			if k.Public && !slices.Contains(config.PublicScopes, s) {
+				continue
+			}
+			key.scopes = append(key.scopes, Scope(s))
+		}
+		a.keys = append(a.keys, key)
+	}
+	return a
+}
+
+// Require wraps next so that it only runs for requests carrying an API key
+// with the given scope (or the admin scope).
+func (a *Auth) Require(scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.disabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		presented := requestKey(r)
+		if presented == "" {
+			log.Printf("%s %s rejected: missing API key", r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			http.Error(w, "Missing API key", http.StatusUnauthorized)
+			return
+		}
+
+		key := a.lookup(presented)
+		if key == nil {
+			log.Printf("%s %s rejected: invalid API key", r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		if !slices.Contains(key.scopes, scope) && !slices.Contains(key.scopes, ScopeAdmin) {
+			log.Printf("%s %s rejected: key %q lacks scope %q", r.Method, r.URL.Path, key.name, scope)
+			http.Error(w, "API key not permitted for this endpoint", http.StatusForbidden)
+			return
+		}
+
+		log.Printf("%s %s authenticated as key %q", r.Method, r.URL.Path, key.name)
+		ctx := context.WithValue(r.Context(), keyNameContextKey, key.name)
+		ctx = context.WithValue(ctx, keyPublicContextKey, key.public)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// lookup compares the presented key against every configured key in
+// constant time. Digests are compared so key length isn't leaked either.
+func (a *Auth) lookup(presented string) *apiKey {
+	digest := sha256.Sum256([]byte(presented))
+	var match *apiKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(digest[:], a.keys[i].digest[:]) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	return match
+}
+
+// requestKey extracts the API key from the X-API-Key header or an
+// "Authorization: Bearer" header.
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+)
+
+func TestAuthRequire(t *testing.T) {
+	keys := []config.APIKey{
+		{Name: "storefront", Key: "store-key", Scopes: []string{"quote", "carriers"}},
+		{Name: "ops", Key: "admin-key", Scopes: []string{"admin"}},
+		// Validate rejects this, but Auth mustn't trust that it ran
+		{Name: "web-ui", Key: "public-key", Scopes: []string{"quote", "admin"}, Public: true},
+	}
+	tests := []struct {
+		name       string
+		disabled   bool
+		scope      Scope
+		header     string
+		value      string
+		wantStatus int
+		wantKey    string
+		wantPublic bool
+	}{
+		{"missing key", false, ScopeQuote, "", "", http.StatusUnauthorized, "", false},
+		{"wrong key", false, ScopeQuote, "X-API-Key", "nope", http.StatusUnauthorized, "", false},
+		{"prefix of a key", false, ScopeQuote, "X-API-Key", "store", http.StatusUnauthorized, "", false},
+		{"valid key", false, ScopeQuote, "X-API-Key", "store-key", http.StatusOK, "storefront", false},
+		{"bearer token", false, ScopeCarriers, "Authorization", "Bearer store-key", http.StatusOK, "storefront", false},
+		{"other auth scheme", false, ScopeQuote, "Authorization", "Basic store-key", http.StatusUnauthorized, "", false},
+		{"missing scope", false, ScopeAdmin, "X-API-Key", "store-key", http.StatusForbidden, "", false},
+		{"admin implies quote", false, ScopeQuote, "X-API-Key", "admin-key", http.StatusOK, "ops", false},
+		{"admin implies ship", false, ScopeShip, "X-API-Key", "admin-key", http.StatusOK, "ops", false},
+		{"public key", false, ScopeQuote, "X-API-Key", "public-key", http.StatusOK, "web-ui", true},
+		{"public key can't be admin", false, ScopeAdmin, "X-API-Key", "public-key", http.StatusForbidden, "", false},
+		{"public key can't ship", false, ScopeShip, "X-API-Key", "public-key", http.StatusForbidden, "", false},
+		{"disabled", true, ScopeAdmin, "", "", http.StatusOK, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotKey string
+			var gotPublic bool
+			handler := NewAuth(keys, tt.disabled).Require(tt.scope, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotKey, gotPublic = KeyName(r.Context()), KeyPublic(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/quote", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if gotKey != tt.wantKey || gotPublic != tt.wantPublic {
+				t.Errorf("key = %q (public %v), want %q (public %v)", gotKey, gotPublic, tt.wantKey, tt.wantPublic)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	tests := []struct {
+		name    string
+		remote  string
+		xff     []string
+		trusted []netip.Prefix
+		want    string
+	}{
+		{"no proxy", "203.0.113.7:5123", nil, trusted, "203.0.113.7"},
+		{"untrusted peer's header ignored", "203.0.113.7:5123", []string{"198.51.100.1"}, trusted, "203.0.113.7"},
+		{"no trusted proxies configured", "10.0.0.2:5123", []string{"198.51.100.1"}, nil, "10.0.0.2"},
+		{"trusted proxy", "10.0.0.2:5123", []string{"198.51.100.1"}, trusted, "198.51.100.1"},
+		{"trusted proxy without header", "10.0.0.2:5123", nil, trusted, "10.0.0.2"},
+		{"chain of trusted proxies", "10.0.0.2:5123", []string{"198.51.100.1, 10.0.0.9, 10.0.0.5"}, trusted, "198.51.100.1"},
+		{"spoofed entries left of the client", "10.0.0.2:5123", []string{"1.2.3.4, 198.51.100.1"}, trusted, "198.51.100.1"},
+		{"spoofed trusted address", "10.0.0.2:5123", []string{"10.0.0.7, 198.51.100.1"}, trusted, "198.51.100.1"},
+		{"header split across lines", "10.0.0.2:5123", []string{"1.2.3.4", "198.51.100.1"}, trusted, "198.51.100.1"},
+		{"garbage hop stops the walk", "10.0.0.2:5123", []string{"198.51.100.1, bogus"}, trusted, "10.0.0.2"},
+		{"all hops trusted", "10.0.0.2:5123", []string{"10.0.0.3"}, trusted, "10.0.0.3"},
+		{"ipv6 peer", "[::1]:5123", []string{"2001:db8::5"}, trusted, "2001:db8::5"},
+		{"ipv4-mapped hop", "10.0.0.2:5123", []string{"::ffff:198.51.100.1"}, trusted, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := ClientIP(req, tt.trusted); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
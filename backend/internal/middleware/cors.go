@@ -1,22 +1,108 @@
 package middleware
 
-import "net/http"
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
-// CORS middleware to handle CORS headers
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+)
+
+// CORS returns middleware that applies the configured cross-origin policy.
+// Requests from disallowed origins get no CORS headers, so browsers block
+// them, and their preflights are rejected with 403.
+func CORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The response depends on Origin, so caches must key on it
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			allowed := originAllowed(cfg.AllowedOrigins, origin)
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				if !allowed ||
+					!slices.Contains(cfg.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) ||
+					!headersAllowed(cfg.AllowedHeaders, r.Header.Get("Access-Control-Request-Headers")) {
+					http.Error(w, "CORS preflight rejected", http.StatusForbidden)
+					return
+				}
+				setAllowOrigin(w, cfg, origin)
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				if headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				if cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if allowed {
+				setAllowOrigin(w, cfg, origin)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func setAllowOrigin(w http.ResponseWriter, cfg config.CORSConfig, origin string) {
+	if slices.Contains(cfg.AllowedOrigins, "*") {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if cfg.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
 
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// originAllowed matches origin against exact entries and "scheme://*.domain"
+// wildcards. A wildcard matches subdomains only, not the bare domain.
+func originAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		scheme, host, ok := strings.Cut(pattern, "://*.")
+		if !ok {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(origin, scheme+"://"); ok &&
+			strings.HasSuffix(rest, "."+host) && len(rest) > len(host)+1 {
+			return true
 		}
+	}
+	return false
+}
 
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
+// headersAllowed reports whether every header in a preflight's
+// Access-Control-Request-Headers list is allowed.
+func headersAllowed(allowed []string, requested string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(a, h) }) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{"https://shop.example.com", "https://*.example.org"}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://shop.example.com", true},
+		{"HTTPS://Shop.Example.com", true},
+		{"http://shop.example.com", false},
+		{"https://shop.example.com:8443", false},
+		{"https://evil.shop.example.com", false},
+		{"https://shop.example.com.evil.net", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://.example.org", false},
+		{"https://evilexample.org", false},
+		{"https://a.example.org.evil.net", false},
+		{"http://a.example.org", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := originAllowed(allowed, tt.origin); got != tt.want {
+				t.Errorf("originAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+	if !originAllowed([]string{"*"}, "https://anything.test") {
+		t.Error(`originAllowed("*") = false, want true`)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	cfg := config.CORSConfig{
+		AllowedOrigins:   []string{"https://shop.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "X-API-Key"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	tests := []struct {
+		name            string
+		cfg             config.CORSConfig
+		method          string
+		headers         map[string]string
+		wantStatus      int
+		wantOrigin      string
+		wantNext        bool
+		wantMaxAge      string
+		wantCredentials bool
+	}{
+		{
+			name:       "no origin",
+			method:     "GET",
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:            "allowed origin",
+			method:          "POST",
+			headers:         map[string]string{"Origin": "https://shop.example.com"},
+			wantStatus:      http.StatusOK,
+			wantOrigin:      "https://shop.example.com",
+			wantNext:        true,
+			wantCredentials: true,
+		},
+		{
+			name:            "wildcard subdomain",
+			method:          "GET",
+			headers:         map[string]string{"Origin": "https://eu.example.org"},
+			wantStatus:      http.StatusOK,
+			wantOrigin:      "https://eu.example.org",
+			wantNext:        true,
+			wantCredentials: true,
+		},
+		{
+			name:       "disallowed origin gets no headers",
+			method:     "POST",
+			headers:    map[string]string{"Origin": "https://evil.test"},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+		{
+			name:   "preflight",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://shop.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type, x-api-key",
+			},
+			wantStatus:      http.StatusNoContent,
+			wantOrigin:      "https://shop.example.com",
+			wantMaxAge:      "600",
+			wantCredentials: true,
+		},
+		{
+			name:   "preflight from disallowed origin",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://example.org",
+				"Access-Control-Request-Method": "POST",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "preflight for disallowed method",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://shop.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "preflight for disallowed header",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://shop.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "X-Debug",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "any origin",
+			cfg:        config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, AllowCredentials: true},
+			method:     "GET",
+			headers:    map[string]string{"Origin": "https://anywhere.test"},
+			wantStatus: http.StatusOK,
+			wantOrigin: "*",
+			wantNext:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			if tt.cfg.AllowedOrigins != nil {
+				c = tt.cfg
+			}
+			called := false
+			handler := CORS(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			req := httptest.NewRequest(tt.method, "/api/quote", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if called != tt.wantNext {
+				t.Errorf("next called = %v, want %v", called, tt.wantNext)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Max-Age"); got != tt.wantMaxAge {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", got, tt.wantMaxAge)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials set = %v, want %v", got, tt.wantCredentials)
+			}
+			if !slices.Contains(rec.Header().Values("Vary"), "Origin") {
+				t.Errorf("Vary = %q, want Origin", rec.Header().Values("Vary"))
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
+)
+
+// idleBucketTTL is how long a client's bucket is kept after its last request.
+const idleBucketTTL = 10 * time.Minute
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter is a per-client token-bucket limiter for a single route.
+// Clients are identified by API key name when authenticated, otherwise by
+// client IP. A public key is shared by every browser that loads the UI, so
+// its clients are the key name and IP together.
+type RateLimiter struct {
+	route   string
+	limit   config.RateLimit
+	trusted []netip.Prefix
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter creates a RateLimiter for the named route.
+func NewRateLimiter(route string, limit config.RateLimit, trusted []netip.Prefix) *RateLimiter {
+	return &RateLimiter{
+		route:     route,
+		limit:     limit,
+		trusted:   trusted,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Limit wraps next, answering 429 with Retry-After once a client's bucket is
+// empty. Inside Auth.Require clients are keyed by API key name, plus client
+// IP for public keys; outside it every request is keyed by client IP.
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	if l.limit.PerSecond() == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r, l.trusted)
+		client := "ip:" + ip
+		if name := KeyName(r.Context()); name != "" {
+			client = "key:" + name
+			if KeyPublic(r.Context()) {
+				client += "|ip:" + ip
+			}
+		}
+
+		reservation := l.bucketFor(client).Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			reservation.Cancel()
+			metrics.RateLimited.WithLabelValues(l.route).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bucketFor returns the client's limiter, creating it on first use and
+// dropping buckets that have sat idle.
+func (l *RateLimiter) bucketFor(client string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleBucketTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(l.limit.PerSecond()), l.limit.Burst)}
+		l.buckets[client] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
+)
+
+// limited wraps an OK handler in auth with keys and a quote rate limiter.
+func limited(keys []config.APIKey, limit config.RateLimit) http.Handler {
+	limiter := NewRateLimiter("quote", limit, nil)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return NewAuth(keys, false).Require(ScopeQuote, limiter.Limit(ok))
+}
+
+func request(handler http.Handler, remote, key string) int {
+	req := httptest.NewRequest(http.MethodPost, "/api/quote", nil)
+	req.RemoteAddr = remote
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestRateLimiterPublicKeyPerIP(t *testing.T) {
+	keys := []config.APIKey{
+		{Name: "web-ui", Key: "public-key", Scopes: []string{"quote"}, Public: true},
+		{Name: "storefront", Key: "store-key", Scopes: []string{"quote"}},
+	}
+	handler := limited(keys, config.RateLimit{Limit: "1/h", Burst: 1})
+
+	if got := request(handler, "203.0.113.1:1000", "public-key"); got != http.StatusOK {
+		t.Fatalf("first visitor: status = %d, want 200", got)
+	}
+	if got := request(handler, "203.0.113.1:1000", "public-key"); got != http.StatusTooManyRequests {
+		t.Errorf("first visitor again: status = %d, want 429", got)
+	}
+	if got := request(handler, "203.0.113.2:1000", "public-key"); got != http.StatusOK {
+		t.Errorf("second visitor with the same public key: status = %d, want its own bucket", got)
+	}
+
+	// A private key is one client wherever it calls from
+	if got := request(handler, "203.0.113.1:1000", "store-key"); got != http.StatusOK {
+		t.Fatalf("private key: status = %d, want 200", got)
+	}
+	if got := request(handler, "203.0.113.2:1000", "store-key"); got != http.StatusTooManyRequests {
+		t.Errorf("private key from another IP: status = %d, want the shared bucket's 429", got)
+	}
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		limit          config.RateLimit
+		requests       int
+		wantRejected   int
+		wantRetryAfter string
+	}{
+		{"within burst", config.RateLimit{Limit: "60/m", Burst: 3}, 3, 0, ""},
+		{"past burst", config.RateLimit{Limit: "60/m", Burst: 3}, 5, 2, "1"},
+		{"slow refill", config.RateLimit{Limit: "1/h", Burst: 1}, 2, 1, "3600"},
+		{"fractional wait rounds up", config.RateLimit{Limit: "40/m", Burst: 1}, 2, 1, "2"},
+		{"disabled", config.RateLimit{}, 10, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := "test-" + tt.name
+			handler := NewRateLimiter(route, tt.limit, nil).Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			before := testutil.ToFloat64(metrics.RateLimited.WithLabelValues(route))
+
+			rejected, retryAfter := 0, ""
+			for range tt.requests {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = "203.0.113.1:1000"
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code == http.StatusTooManyRequests {
+					rejected++
+					retryAfter = rec.Header().Get("Retry-After")
+				}
+			}
+
+			if rejected != tt.wantRejected {
+				t.Errorf("rejected %d requests, want %d", rejected, tt.wantRejected)
+			}
+			if retryAfter != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", retryAfter, tt.wantRetryAfter)
+			}
+			if got := testutil.ToFloat64(metrics.RateLimited.WithLabelValues(route)) - before; got != float64(tt.wantRejected) {
+				t.Errorf("rate_limited_requests_total{route=%q} rose by %v, want %d", route, got, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestRateLimiterRoutesAreIndependent(t *testing.T) {
+	limit := config.RateLimit{Limit: "1/h", Burst: 1}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	quote := NewRateLimiter("quote", limit, nil).Limit(ok)
+	carriers := NewRateLimiter("carriers", limit, nil).Limit(ok)
+
+	for _, tt := range []struct {
+		name    string
+		handler http.Handler
+		want    int
+	}{
+		{"quote", quote, http.StatusOK},
+		{"carriers", carriers, http.StatusOK},
+		{"quote again", quote, http.StatusTooManyRequests},
+		{"carriers again", carriers, http.StatusTooManyRequests},
+	} {
+		if got := request(tt.handler, "203.0.113.1:1000", ""); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
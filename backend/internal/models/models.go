@@ -1,12 +1,21 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
 
-// PackageItem represents a single item to be shipped
+// PackageItem represents a single item to be shipped. Weight is in
+// WeightUOM (lb, oz, kg or g) and dimensions in DimensionUOM (in or cm),
+// pounds and inches when unset; the units package normalizes both.
 type PackageItem struct {
 	Length          float64 `json:"length,omitempty"`
 	Width           float64 `json:"width,omitempty"`
 	Height          float64 `json:"height,omitempty"`
+	DimensionUOM    string  `json:"dimension_uom,omitempty"`
 	Weight          float64 `json:"weight"`
 	WeightUOM       string  `json:"weight_uom,omitempty"`
 	Qty             int     `json:"qty,omitempty"`
@@ -34,14 +43,81 @@ type Address struct {
 
 // ShipmentRequest represents the request for rate quotes
 type ShipmentRequest struct {
-	OriginZip             string        `json:"origin_zip,omitempty"`
-	DestinationZip        string        `json:"destination_zip,omitempty"`
-	DestinationCountryID  string        `json:"destination_country_id,omitempty"`
-	Items                 []PackageItem `json:"items"`
-	OriginAddress         *Address      `json:"origin_address,omitempty"`
-	DestinationAddress    *Address      `json:"destination_address,omitempty"`
-	WarehouseCode         string        `json:"warehouse_code,omitempty"`
-	CarrierFilter         []string      `json:"carrier_filter,omitempty"`
+	OriginZip            string        `json:"origin_zip,omitempty"`
+	DestinationZip       string        `json:"destination_zip,omitempty"`
+	DestinationCountryID string        `json:"destination_country_id,omitempty"`
+	Items                []PackageItem `json:"items"`
+	OriginAddress        *Address      `json:"origin_address,omitempty"`
+	DestinationAddress   *Address      `json:"destination_address,omitempty"`
+	WarehouseCode        string        `json:"warehouse_code,omitempty"`
+	CarrierFilter        []string      `json:"carrier_filter,omitempty"`
+	USPS                 *USPSOptions  `json:"usps,omitempty"`
+
+	// ExtraServices asks for optional services such as "insurance";
+	// insurance covers InsuredValue, or the items' total value if unset.
+	ExtraServices []string `json:"extra_services,omitempty"`
+	InsuredValue  float64  `json:"insured_value,omitempty"`
+
+	// Currency is the ISO 4217 code to show prices in, such as "CAD";
+	// empty keeps the providers' currency.
+	Currency string `json:"currency,omitempty"`
+}
+
+// Extra services a ShipmentRequest may ask for
+const (
+	ExtraInsurance                = "insurance"
+	ExtraSignature                = "signature"
+	ExtraAdultSignature           = "adult_signature"
+	ExtraAdultSignatureRestricted = "adult_signature_restricted"
+)
+
+// OriginPostalCode returns OriginZip, or the origin address's ZIP.
+func (r *ShipmentRequest) OriginPostalCode() string {
+	if r.OriginZip == "" && r.OriginAddress != nil {
+		return r.OriginAddress.Zip
+	}
+	return r.OriginZip
+}
+
+// DestinationPostalCode returns DestinationZip, or the destination
+// address's postal code.
+func (r *ShipmentRequest) DestinationPostalCode() string {
+	if r.DestinationZip == "" && r.DestinationAddress != nil {
+		return r.DestinationAddress.Zip
+	}
+	return r.DestinationZip
+}
+
+// DestinationCountry returns DestinationCountryID, or the destination
+// address's country. Empty means the US.
+func (r *ShipmentRequest) DestinationCountry() string {
+	if r.DestinationCountryID == "" && r.DestinationAddress != nil {
+		return r.DestinationAddress.Country
+	}
+	return r.DestinationCountryID
+}
+
+// DeclaredValue returns InsuredValue, or the total value of the items.
+func (r *ShipmentRequest) DeclaredValue() float64 {
+	if r.InsuredValue > 0 {
+		return r.InsuredValue
+	}
+	var total float64
+	for _, item := range r.Items {
+		total += item.Value * float64(max(item.Quantity, 1))
+	}
+	return total
+}
+
+// USPSOptions overrides the configured USPS pricing for one request; empty
+// fields keep the configured value. Packaging names USPS containers, such
+// as "medium_flat_rate_box", to quote alongside the custom box.
+type USPSOptions struct {
+	MailClasses   []string `json:"mail_classes,omitempty"`
+	PriceType     string   `json:"price_type,omitempty"`
+	AccountType   string   `json:"account_type,omitempty"`
+	AccountNumber string   `json:"account_number,omitempty"`
+	Packaging     []string `json:"packaging,omitempty"`
 }
 
 // ShipHawkRequest represents the request format for ShipHawk API
@@ -70,6 +146,200 @@ type Rate struct {
 	ServiceDays         int     `json:"service_days"`
 	RatesProvider       string  `json:"rates_provider"`
 	InsurancePrice      float64 `json:"insurance_price"`
+	// RateIndicator is the USPS rate indicator (SP, PA, CP); empty for
+	// ShipHawk rates.
+	RateIndicator string `json:"rate_indicator,omitempty"`
+	// ExtraServices are the requested extras priced for this rate.
+	// TotalPrice is Price plus their prices.
+	ExtraServices []ExtraServicePrice `json:"extra_services,omitempty"`
+	TotalPrice    string              `json:"total_price"`
+	// Surcharges are the fees included in Price; BasePrice is Price
+	// without them.
+	Surcharges []Surcharge `json:"surcharges,omitempty"`
+	BasePrice  string      `json:"base_price,omitempty"`
+	// Duties and Taxes are what ShipHawk quotes on top of the shipping
+	// price for international destinations. LandedCost is the
+	// delivered-duty-paid total: ShipHawk's landed_cost, or Price plus
+	// duties and taxes when it doesn't send one.
+	Duties     Amount `json:"duties,omitempty"`
+	Taxes      Amount `json:"taxes,omitempty"`
+	LandedCost string `json:"landed_cost,omitempty"`
+	// OriginalPrice and OriginalCurrency are the quoted price before
+	// conversion to the requested Currency at ExchangeRate.
+	OriginalPrice    string  `json:"original_price,omitempty"`
+	OriginalCurrency string  `json:"original_currency,omitempty"`
+	ExchangeRate     float64 `json:"exchange_rate,omitempty"`
+	// Raw keeps any fields of the ShipHawk rate not parsed above.
+	Raw map[string]json.RawMessage `json:"raw,omitempty"`
+}
+
+// Surcharge is one fee included in a rate's price. Code is one of the
+// Surcharge constants; CarrierCode is the code the carrier sent, if any.
+type Surcharge struct {
+	Code        string `json:"code"`
+	CarrierCode string `json:"carrier_code,omitempty"`
+	Description string `json:"description,omitempty"`
+	Amount      Amount `json:"amount"`
+}
+
+// Normalized surcharge codes
+const (
+	SurchargeFuel               = "fuel"
+	SurchargeResidential        = "residential"
+	SurchargeDeliveryArea       = "delivery_area"
+	SurchargeAdditionalHandling = "additional_handling"
+	SurchargeOversize           = "oversize"
+	SurchargeNonstandard        = "nonstandard"
+	SurchargeSignature          = "signature"
+	SurchargeDuties             = "duties_and_taxes"
+	SurchargeOther              = "other"
+)
+
+// surchargeKeywords map phrases in carrier surcharge codes and
+// descriptions to normalized codes, checked in order.
+var surchargeKeywords = []struct{ keyword, code string }{
+	{"fuel", SurchargeFuel},
+	{"residential", SurchargeResidential},
+	{"delivery area", SurchargeDeliveryArea},
+	{"remote area", SurchargeDeliveryArea},
+	{"additional handling", SurchargeAdditionalHandling},
+	{"oversize", SurchargeOversize},
+	{"large package", SurchargeOversize},
+	{"nonstandard", SurchargeNonstandard},
+	{"non standard", SurchargeNonstandard},
+	{"signature", SurchargeSignature},
+	{"duties", SurchargeDuties},
+	{"duty", SurchargeDuties},
+}
+
+// surchargeAbbreviations map carrier abbreviations, matched as whole words.
+var surchargeAbbreviations = map[string]string{
+	"fsc":  SurchargeFuel,
+	"resi": SurchargeResidential,
+	"das":  SurchargeDeliveryArea,
+	"edas": SurchargeDeliveryArea,
+	"ahs":  SurchargeAdditionalHandling,
+	"ddp":  SurchargeDuties,
+}
+
+// NormalizeSurchargeCode maps a carrier's surcharge code and description to
+// one of the Surcharge constants, SurchargeOther if nothing matches.
+func NormalizeSurchargeCode(code, description string) string {
+	text := strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(code + " " + description))
+	for _, k := range surchargeKeywords {
+		if strings.Contains(text, k.keyword) {
+			return k.code
+		}
+	}
+	for _, word := range strings.Fields(text) {
+		if normalized, ok := surchargeAbbreviations[word]; ok {
+			return normalized
+		}
+	}
+	return SurchargeOther
+}
+
+// Amount is a money amount that ShipHawk may send as a number or a string.
+// Anything else decodes as zero rather than failing the whole response;
+// Rate keeps such values in Raw.
+type Amount float64
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	*a, _ = parseAmount(data)
+	return nil
+}
+
+// parseAmount parses a JSON number or numeric string, reporting false for
+// anything else. Empty strings and null are a valid zero.
+func parseAmount(data []byte) (Amount, bool) {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		return 0, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return Amount(f), true
+}
+
+// validAmounts reports whether the amounts in a rate field decoded as
+// Amount parse. Fields without amounts are always valid.
+func validAmounts(key string, value json.RawMessage) bool {
+	switch key {
+	case "duties", "taxes", "landed_cost":
+		_, ok := parseAmount(value)
+		return ok
+	case "surcharges":
+		var surcharges []struct {
+			Amount json.RawMessage `json:"amount"`
+		}
+		if json.Unmarshal(value, &surcharges) != nil {
+			return true
+		}
+		for _, sc := range surcharges {
+			if _, ok := parseAmount(sc.Amount); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rateFields are the JSON keys of Rate's typed fields.
+var rateFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeFor[Rate]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// UnmarshalJSON decodes a rate, keeping fields it doesn't know, and amounts
+// it can't parse, in Raw. LandedCost may arrive as a number or a string.
+// Rate is also our own response type, so decoding doesn't normalize
+// anything: providers' rates are mapped in the services package.
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	type rate Rate
+	aux := struct {
+		*rate
+		LandedCost *Amount `json:"landed_cost"`
+	}{rate: (*rate)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+	r.Raw = nil
+	for key, value := range all {
+		if rateFields[key] && validAmounts(key, value) {
+			continue
+		}
+		if r.Raw == nil {
+			r.Raw = make(map[string]json.RawMessage)
+		}
+		r.Raw[key] = value
+	}
+
+	if aux.LandedCost != nil {
+		r.LandedCost = fmt.Sprintf("%.2f", float64(*aux.LandedCost))
+	}
+	return nil
+}
+
+// ExtraServicePrice is the price of one extra service on a Rate
+type ExtraServicePrice struct {
+	Service string  `json:"service"`
+	Code    string  `json:"code"`
+	Name    string  `json:"name"`
+	Price   float64 `json:"price"`
 }
 
 // ShipHawkError is one per-carrier error entry from ShipHawk.
@@ -81,8 +351,8 @@ type ShipHawkError struct {
 }
 
 // ShipHawkDebug carries raw request/response bodies so callers can inspect
-// everything ShipHawk sent — including fields we don't currently parse into
-// the typed Rate struct (duties, taxes, quoted_value, surcharges, etc.).
+// exactly what ShipHawk sent. Rate fields we don't parse are also kept
+// per rate in Rate.Raw.
 type ShipHawkDebug struct {
 	Request  json.RawMessage `json:"request,omitempty"`
 	Response json.RawMessage `json:"response,omitempty"`
@@ -102,12 +372,12 @@ type Carrier struct {
 	CarrierType struct {
 		Code string `json:"code"`
 	} `json:"carrier_type"`
-	Name                string   `json:"name"`
-	IsEnabled           bool     `json:"is_enabled"`
-	Activatable         bool     `json:"activatable"`
+	Name                string            `json:"name"`
+	IsEnabled           bool              `json:"is_enabled"`
+	Activatable         bool              `json:"activatable"`
 	RequiredCredentials []json.RawMessage `json:"required_credentials"`
 	OptionalCredentials []json.RawMessage `json:"optional_credentials"`
-	TestMode            bool     `json:"test_mode"`
-	Status              string   `json:"status"`
-	Logo                string   `json:"logo"`
+	TestMode            bool              `json:"test_mode"`
+	Status              string            `json:"status"`
+	Logo                string            `json:"logo"`
 }
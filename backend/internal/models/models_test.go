@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRateUnmarshalKeepsUnparseableAmounts(t *testing.T) {
+	data := `{"rates":[{"id":"r1","price":"20.00","duties":"n/a","taxes":1.5,` +
+		`"surcharges":[{"code":"FSC","amount":"TBD"}]}]}`
+	var resp ShipHawkResponse
+	if err := json.Unmarshal([]byte(data), &resp); err != nil {
+		t.Fatalf("Unmarshal() error = %v, want the response to decode", err)
+	}
+	rate := resp.Rates[0]
+	if rate.Duties != 0 || rate.Taxes != 1.5 {
+		t.Errorf("duties, taxes = %v, %v, want 0, 1.5", rate.Duties, rate.Taxes)
+	}
+	if len(rate.Surcharges) != 1 || rate.Surcharges[0].Amount != 0 {
+		t.Errorf("surcharges = %+v, want one with a zero amount", rate.Surcharges)
+	}
+	if got := string(rate.Raw["duties"]); got != `"n/a"` {
+		t.Errorf("Raw[duties] = %s, want \"n/a\"", got)
+	}
+	if _, ok := rate.Raw["surcharges"]; !ok {
+		t.Error("Raw[surcharges] missing, want the unparseable surcharges kept")
+	}
+	if _, ok := rate.Raw["taxes"]; ok {
+		t.Error("Raw[taxes] set, want parsed amounts left out of Raw")
+	}
+}
+
+func TestRateRoundTripKeepsFields(t *testing.T) {
+	want := Rate{
+		ID:         "r1",
+		Price:      "20.00",
+		BasePrice:  "12.00",
+		Duties:     3,
+		LandedCost: "23.00",
+		Surcharges: []Surcharge{{Code: SurchargeOther, CarrierCode: "FSC", Description: "Peak", Amount: 8}},
+	}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Rate
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Surcharges[0] != want.Surcharges[0] {
+		t.Errorf("surcharge = %+v, want %+v unchanged", got.Surcharges[0], want.Surcharges[0])
+	}
+	if got.BasePrice != want.BasePrice || got.LandedCost != want.LandedCost {
+		t.Errorf("base price, landed cost = %s, %s, want %s, %s", got.BasePrice, got.LandedCost, want.BasePrice, want.LandedCost)
+	}
+}
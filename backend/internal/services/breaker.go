@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/breaker"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/usps"
+)
+
+func newBreaker(provider string, cfg config.BreakerConfig) *breaker.Breaker {
+	return breaker.New(provider, breaker.Settings{
+		ConsecutiveFailures: cfg.ConsecutiveFailures,
+		ErrorRate:           cfg.ErrorRate,
+		MinRequests:         cfg.MinRequests,
+		Window:              cfg.Window,
+		OpenTimeout:         cfg.OpenTimeout,
+	})
+}
+
+// upstreamOutcome classifies an upstream call for the circuit breaker.
+// Transport errors, 429 and 5xx count against the provider; other 4xx
+// responses (such as ShipHawk's per-carrier 422s) mean it is up and
+// answering. Calls abandoned by our own caller are ignored.
+func upstreamOutcome(ctx context.Context, err error, status int) breaker.Outcome {
+	if ctx.Err() != nil {
+		return breaker.Ignored
+	}
+	var statusErr *usps.StatusError
+	if errors.As(err, &statusErr) {
+		status, err = statusErr.StatusCode, nil
+	}
+	if err != nil || status == http.StatusTooManyRequests || status >= 500 {
+		return breaker.Failure
+	}
+	return breaker.Success
+}
@@ -1,36 +1,39 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
 )
 
 type CarrierService struct {
 	cfg      *config.Config
+	client   *http.Client
 	carriers []models.Carrier
 }
 
-func NewCarrierService(cfg *config.Config) *CarrierService {
+func NewCarrierService(cfg *config.Config, client *http.Client) *CarrierService {
 	return &CarrierService{
-		cfg: cfg,
+		cfg:    cfg,
+		client: client,
 	}
 }
 
 func (s *CarrierService) Initialize() error {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v4/carriers", s.cfg.ShipHawkBaseURL), nil)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v4/carriers", s.cfg.ShipHawk.BaseURL), nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	req.Header.Set("X-API-Key", s.cfg.ShipHawkAPIKey)
+	req.Header.Set("X-API-Key", s.cfg.ShipHawk.APIKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to fetch carriers: %v", err)
 	}
@@ -46,9 +49,18 @@ func (s *CarrierService) Initialize() error {
 	}
 
 	s.carriers = carriers
+	metrics.CarriersLoaded.Set(float64(len(carriers)))
 	return nil
 }
 
 func (s *CarrierService) GetCarriers() []models.Carrier {
 	return s.carriers
 }
+
+// Ping reports whether the carrier list has been loaded.
+func (s *CarrierService) Ping(ctx context.Context) error {
+	if len(s.carriers) == 0 {
+		return fmt.Errorf("no carriers loaded")
+	}
+	return nil
+}
@@ -2,33 +2,47 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
 
+	"github.com/muscleandstrength/GoShiphawkRates/internal/breaker"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
 )
 
 // ShipHawkService handles interactions with the ShipHawk API
 type ShipHawkService struct {
-	config *config.Config
+	config  *config.Config
+	client  *http.Client
+	breaker *breaker.Breaker
 }
 
 // NewShipHawkService creates a new ShipHawkService instance
-func NewShipHawkService(cfg *config.Config) *ShipHawkService {
+func NewShipHawkService(cfg *config.Config, client *http.Client) *ShipHawkService {
 	return &ShipHawkService{
-		config: cfg,
+		config:  cfg,
+		client:  client,
+		breaker: newBreaker("ShipHawk", cfg.Breaker),
 	}
 }
 
+// Breaker returns the circuit breaker guarding ShipHawk rate requests
+func (s *ShipHawkService) Breaker() *breaker.Breaker {
+	return s.breaker
+}
+
 // GetRateQuotes gets shipping rate quotes from ShipHawk
-func (s *ShipHawkService) GetRateQuotes(req *models.ShipmentRequest) (*models.ShipHawkResponse, error) {
+func (s *ShipHawkService) GetRateQuotes(ctx context.Context, req *models.ShipmentRequest) (*models.ShipHawkResponse, error) {
 	// Create ShipHawk request
 	shipHawkReq := models.ShipHawkRequest{
-		Items:              req.Items,
+		Items:              slices.Clone(req.Items),
 		OriginAddress:      req.OriginAddress,
 		DestinationAddress: req.DestinationAddress,
 		WarehouseCode:      req.WarehouseCode,
@@ -64,9 +78,12 @@ func (s *ShipHawkService) GetRateQuotes(req *models.ShipmentRequest) (*models.Sh
 		}
 	}
 
-	// Ensure destination address has correct country from request
+	// Ensure destination address has correct country from request. The
+	// address and items are copies: the request is shared with USPS.
 	if shipHawkReq.DestinationAddress != nil && req.DestinationCountryID != "" {
-		shipHawkReq.DestinationAddress.Country = req.DestinationCountryID
+		address := *shipHawkReq.DestinationAddress
+		address.Country = req.DestinationCountryID
+		shipHawkReq.DestinationAddress = &address
 	}
 
 	// Ensure all items have quantity set (convert from Qty if needed)
@@ -105,23 +122,31 @@ func (s *ShipHawkService) GetRateQuotes(req *models.ShipmentRequest) (*models.Sh
 	}
 
 	// Create request to ShipHawk API
-	ratesURL := fmt.Sprintf("%s/api/v4/rates", s.config.ShipHawkBaseURL)
-	httpReq, err := http.NewRequest("POST", ratesURL, bytes.NewBuffer(requestBody))
+	ratesURL := fmt.Sprintf("%s/api/v4/rates", s.config.ShipHawk.BaseURL)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", ratesURL, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-API-KEY", s.config.ShipHawkAPIKey)
+	httpReq.Header.Set("X-API-KEY", s.config.ShipHawk.APIKey)
+
+	// Fail fast while ShipHawk is known to be down
+	done, err := s.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
 
 	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
+	resp, err := s.client.Do(httpReq)
 	if err != nil {
+		done(upstreamOutcome(ctx, err, 0))
+		metrics.UpstreamErrors.WithLabelValues("shiphawk", "").Inc()
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	done(upstreamOutcome(ctx, nil, resp.StatusCode))
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
@@ -136,10 +161,17 @@ func (s *ShipHawkService) GetRateQuotes(req *models.ShipmentRequest) (*models.Sh
 	// per-carrier errors in the body that callers want to surface to the user.
 	var shipHawkResp models.ShipHawkResponse
 	parseErr := json.Unmarshal(body, &shipHawkResp)
+	for i := range shipHawkResp.Rates {
+		normalizeRate(&shipHawkResp.Rates[i])
+		metrics.UpstreamRates.WithLabelValues("shiphawk", shipHawkResp.Rates[i].CarrierCode).Inc()
+	}
+	for _, e := range shipHawkResp.Errors {
+		metrics.UpstreamErrors.WithLabelValues("shiphawk", e.CarrierCode).Inc()
+	}
 
 	debug := &models.ShipHawkDebug{
 		Request:  json.RawMessage(requestBody),
-		Response: json.RawMessage(body),
+		Response: rawJSON(body),
 		Status:   resp.StatusCode,
 	}
 
@@ -160,3 +192,58 @@ func (s *ShipHawkService) GetRateQuotes(req *models.ShipmentRequest) (*models.Sh
 
 	return &shipHawkResp, nil
 }
+
+// normalizeRate maps ShipHawk's surcharge codes to ours, keeping the
+// carrier's code, and works out BasePrice, and LandedCost when duties or
+// taxes are quoted without one.
+func normalizeRate(rate *models.Rate) {
+	var surcharges models.Amount
+	for i, sc := range rate.Surcharges {
+		if sc.CarrierCode == "" {
+			rate.Surcharges[i].CarrierCode = sc.Code
+		}
+		rate.Surcharges[i].Code = models.NormalizeSurchargeCode(sc.Code, sc.Description)
+		surcharges += sc.Amount
+	}
+	price, err := strconv.ParseFloat(rate.Price, 64)
+	if err != nil {
+		return
+	}
+	if rate.BasePrice == "" {
+		rate.BasePrice = fmt.Sprintf("%.2f", price-float64(surcharges))
+	}
+	if rate.LandedCost == "" && (rate.Duties != 0 || rate.Taxes != 0) {
+		rate.LandedCost = fmt.Sprintf("%.2f", price+float64(rate.Duties+rate.Taxes))
+	}
+}
+
+// rawJSON returns body for embedding in our own JSON response, quoted as a
+// string when it isn't JSON (such as a proxy's HTML error page).
+func rawJSON(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// Ping checks that the ShipHawk API is reachable and accepts our API key.
+func (s *ShipHawkService) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/api/v4/carriers", s.config.ShipHawk.BaseURL), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-API-KEY", s.config.ShipHawk.APIKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach ShipHawk: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ShipHawk returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/fakeshiphawk"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+)
+
+// newTestShipHawkService starts a fake ShipHawk server running scenario and
+// returns a service pointed at it.
+func newTestShipHawkService(t *testing.T, scenario string) (*ShipHawkService, *fakeshiphawk.Server) {
+	t.Helper()
+	fixtures, err := fakeshiphawk.Scenario(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := fakeshiphawk.New(fixtures, "test-key")
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cfg := config.Defaults()
+	cfg.ShipHawk.BaseURL = srv.URL
+	cfg.ShipHawk.APIKey = "test-key"
+	return NewShipHawkService(cfg, srv.Client()), fake
+}
+
+func shipmentRequest() *models.ShipmentRequest {
+	return &models.ShipmentRequest{
+		OriginZip:      "10001",
+		DestinationZip: "90210",
+		Items:          []models.PackageItem{{Weight: 2, Length: 10, Width: 8, Height: 6, Qty: 1}},
+	}
+}
+
+func rateIDs(resp *models.ShipHawkResponse) []string {
+	var ids []string
+	if resp != nil {
+		for _, r := range resp.Rates {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+func errorCarriers(resp *models.ShipHawkResponse) []string {
+	var codes []string
+	if resp != nil {
+		for _, e := range resp.Errors {
+			codes = append(codes, e.CarrierCode)
+		}
+	}
+	return codes
+}
+
+func TestShipHawkServiceGetRateQuotes(t *testing.T) {
+	// Each call is one GetRateQuotes against the same fake, so scripted
+	// sequences such as "flaky" can be checked call by call.
+	type call struct {
+		wantRates  []string
+		wantErrors []string
+		wantErr    bool
+		wantStatus int
+	}
+	tests := []struct {
+		scenario string
+		timeout  time.Duration
+		calls    []call
+	}{
+		{
+			scenario: "ok",
+			calls:    []call{{wantRates: []string{"rate_ups_ground", "rate_fedex_2day"}, wantStatus: http.StatusOK}},
+		},
+		{
+			scenario: "unprocessable",
+			calls: []call{{
+				wantRates:  []string{"rate_ups_ground"},
+				wantErrors: []string{"fedex", "dhl_ecommerce"},
+				wantErr:    true,
+				wantStatus: http.StatusUnprocessableEntity,
+			}},
+		},
+		{
+			scenario: "server_error",
+			calls:    []call{{wantErr: true, wantStatus: http.StatusBadGateway}},
+		},
+		{
+			scenario: "flaky",
+			calls: []call{
+				{wantErr: true, wantStatus: http.StatusBadGateway},
+				{wantRates: []string{"rate_ups_ground", "rate_fedex_2day"}, wantStatus: http.StatusOK},
+			},
+		},
+		{
+			scenario: "malformed",
+			calls:    []call{{wantErr: true, wantStatus: http.StatusOK}},
+		},
+		{
+			scenario: "slow",
+			timeout:  100 * time.Millisecond,
+			calls:    []call{{wantErr: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scenario, func(t *testing.T) {
+			service, fake := newTestShipHawkService(t, tt.scenario)
+			for i, c := range tt.calls {
+				ctx := context.Background()
+				if tt.timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+					defer cancel()
+				}
+
+				resp, err := service.GetRateQuotes(ctx, shipmentRequest())
+				if (err != nil) != c.wantErr {
+					t.Fatalf("call %d: err = %v, want error %v", i+1, err, c.wantErr)
+				}
+				if got := rateIDs(resp); !slices.Equal(got, c.wantRates) {
+					t.Errorf("call %d: rates = %v, want %v", i+1, got, c.wantRates)
+				}
+				if got := errorCarriers(resp); !slices.Equal(got, c.wantErrors) {
+					t.Errorf("call %d: carrier errors = %v, want %v", i+1, got, c.wantErrors)
+				}
+				var status int
+				if resp != nil && resp.Debug != nil {
+					status = resp.Debug.Status
+				}
+				if status != c.wantStatus {
+					t.Errorf("call %d: upstream status = %d, want %d", i+1, status, c.wantStatus)
+				}
+			}
+			if got := len(fake.Requests()); got != len(tt.calls) {
+				t.Errorf("fake received %d rates requests, want %d", got, len(tt.calls))
+			}
+		})
+	}
+}
+
+func TestShipHawkServiceSendsAPIKeyAndDefaults(t *testing.T) {
+	service, fake := newTestShipHawkService(t, "ok")
+	if _, err := service.GetRateQuotes(context.Background(), shipmentRequest()); err != nil {
+		t.Fatal(err)
+	}
+	requests := fake.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("fake received %d requests, want 1", len(requests))
+	}
+	if requests[0].APIKey != "test-key" {
+		t.Errorf("API key = %q, want test-key", requests[0].APIKey)
+	}
+	var sent models.ShipHawkRequest
+	if err := json.Unmarshal(requests[0].Body, &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.WarehouseCode != "01" {
+		t.Errorf("warehouse code = %q, want the default 01", sent.WarehouseCode)
+	}
+	if len(sent.Items) != 1 || sent.Items[0].Quantity != 1 {
+		t.Errorf("items = %+v, want one item with quantity 1", sent.Items)
+	}
+	if sent.DestinationAddress == nil || sent.DestinationAddress.Zip != "90210" || sent.DestinationAddress.Country != "US" {
+		t.Errorf("destination = %+v, want a US address for 90210", sent.DestinationAddress)
+	}
+}
+
+func TestShipHawkServiceLeavesRequestUnchanged(t *testing.T) {
+	service, _ := newTestShipHawkService(t, "ok")
+	req := shipmentRequest()
+	req.DestinationCountryID = "CA"
+	req.DestinationAddress = &models.Address{Zip: "M5V 2T6"}
+	if _, err := service.GetRateQuotes(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if item := req.Items[0]; item.Name != "" || item.Quantity != 0 || item.CountryOfOrigin != "" {
+		t.Errorf("item = %+v, want the defaults applied to a copy", item)
+	}
+	if req.DestinationAddress.Country != "" {
+		t.Errorf("destination country = %q, want it set on a copy", req.DestinationAddress.Country)
+	}
+}
+
+func TestShipHawkServiceNormalizesRates(t *testing.T) {
+	service, _ := newTestShipHawkService(t, "international")
+	resp, err := service.GetRateQuotes(context.Background(), shipmentRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id         string
+		codes      []string
+		basePrice  string
+		landedCost string
+	}{
+		{"rate_ups_worldwide_expedited", []string{models.SurchargeFuel + "/fuel", models.SurchargeDuties + "/ddp"}, "67.88", "122.28"},
+		{"rate_fedex_intl_economy", []string{models.SurchargeFuel + "/FUEL"}, "62.69", "108.50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			i := slices.IndexFunc(resp.Rates, func(r models.Rate) bool { return r.ID == tt.id })
+			if i < 0 {
+				t.Fatalf("rates = %v, want %s", rateIDs(resp), tt.id)
+			}
+			rate := resp.Rates[i]
+			var codes []string
+			for _, sc := range rate.Surcharges {
+				codes = append(codes, sc.Code+"/"+sc.CarrierCode)
+			}
+			if !slices.Equal(codes, tt.codes) {
+				t.Errorf("surcharges = %v, want %v", codes, tt.codes)
+			}
+			if rate.BasePrice != tt.basePrice {
+				t.Errorf("base price = %s, want %s", rate.BasePrice, tt.basePrice)
+			}
+			if rate.LandedCost != tt.landedCost {
+				t.Errorf("landed cost = %s, want %s", rate.LandedCost, tt.landedCost)
+			}
+		})
+	}
+}
+
+func TestShipHawkServiceCountsPerCarrier(t *testing.T) {
+	counts := func() map[string]float64 {
+		return map[string]float64{
+			"ups rates":    testutil.ToFloat64(metrics.UpstreamRates.WithLabelValues("shiphawk", "ups")),
+			"fedex rates":  testutil.ToFloat64(metrics.UpstreamRates.WithLabelValues("shiphawk", "fedex")),
+			"fedex errors": testutil.ToFloat64(metrics.UpstreamErrors.WithLabelValues("shiphawk", "fedex")),
+			"dhl errors":   testutil.ToFloat64(metrics.UpstreamErrors.WithLabelValues("shiphawk", "dhl_ecommerce")),
+			"no carrier":   testutil.ToFloat64(metrics.UpstreamErrors.WithLabelValues("shiphawk", "")),
+		}
+	}
+	service, _ := newTestShipHawkService(t, "unprocessable")
+	before := counts()
+	_, _ = service.GetRateQuotes(context.Background(), shipmentRequest())
+	after := counts()
+
+	want := map[string]float64{"ups rates": 1, "fedex rates": 0, "fedex errors": 1, "dhl errors": 1, "no carrier": 0}
+	for name, w := range want {
+		if got := after[name] - before[name]; got != w {
+			t.Errorf("%s rose by %v, want %v", name, got, w)
+		}
+	}
+}
@@ -2,11 +2,21 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/muscleandstrength/GoShiphawkRates/internal/breaker"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/destination"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/health"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/middleware"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
 	"github.com/muscleandstrength/GoShiphawkRates/internal/usps"
 )
@@ -15,96 +25,481 @@ import (
 // ShipHawk's USPS carrier, which flows through the ShipHawk service).
 type USPSService struct {
 	uspsClient *usps.RateService
+	breaker    *breaker.Breaker
 	enabled    bool
+	pricing    config.USPSConfig
 }
 
-// NewUSPSService creates a new USPSService instance. If USPS_CONSUMER_KEY or
-// USPS_CONSUMER_SECRET is unset, returns a disabled service that short-circuits
-// rate requests — this lets the app run without direct USPS credentials.
-func NewUSPSService() (*USPSService, error) {
-	if os.Getenv("USPS_CONSUMER_KEY") == "" || os.Getenv("USPS_CONSUMER_SECRET") == "" {
+// NewUSPSService creates a new USPSService instance. If the USPS consumer key
+// or secret is unset, returns a disabled service that short-circuits rate
+// requests — this lets the app run without direct USPS credentials.
+//
+// It fetches an OAuth token within ctx to check the credentials. Only
+// rejected credentials are an error: if USPS can't be reached the service
+// starts anyway, reports itself unhealthy through Ping and retries the
+// token on the next request.
+func NewUSPSService(ctx context.Context, cfg *config.Config, client *http.Client) (*USPSService, error) {
+	if !cfg.USPS.Enabled() {
 		log.Printf("USPS direct integration disabled: USPS_CONSUMER_KEY or USPS_CONSUMER_SECRET not set")
 		return &USPSService{enabled: false}, nil
 	}
 
-	client, err := usps.NewRateService()
+	// Catch bad pricing defaults at startup rather than on every quote
+	if _, err := usps.ParsePricing(cfg.USPS.MailClasses, cfg.USPS.PriceType, cfg.USPS.AccountType, cfg.USPS.AccountNumber); err != nil {
+		return nil, fmt.Errorf("invalid USPS pricing configuration: %w", err)
+	}
+
+	rateService, err := usps.NewRateService(usps.Config{
+		USPSConsumerKey:    cfg.USPS.ConsumerKey,
+		USPSConsumerSecret: cfg.USPS.ConsumerSecret,
+		USPSBaseURL:        cfg.USPS.BaseURL,
+		HTTPClient:         client,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create USPS service: %w", err)
 	}
+	if err := rateService.Authenticate(ctx); err != nil {
+		if errors.Is(err, usps.ErrInvalidCredentials) {
+			return nil, fmt.Errorf("failed to create USPS service: %w", err)
+		}
+		log.Printf("WARNING: USPS is unavailable, starting without it until a token can be fetched: %v", err)
+	}
 
 	return &USPSService{
-		uspsClient: client,
+		uspsClient: rateService,
+		breaker:    newBreaker("USPS", cfg.Breaker),
 		enabled:    true,
+		pricing:    cfg.USPS,
 	}, nil
 }
 
+// Pricing resolves the USPS pricing for a request: the configured defaults
+// with any fields the request overrides, plus the packaging it asks for. It
+// fails if the request names an unknown mail class, price type, account
+// type or packaging.
+func (s *USPSService) Pricing(override *models.USPSOptions) (usps.Pricing, error) {
+	cfg := s.pricing
+	var errs []error
+	var packaging []usps.Packaging
+	if override != nil {
+		for _, code := range override.Packaging {
+			p, err := usps.LookupPackaging(code)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			packaging = append(packaging, p)
+		}
+		if len(override.MailClasses) > 0 {
+			cfg.MailClasses = override.MailClasses
+		}
+		if override.PriceType != "" {
+			cfg.PriceType = override.PriceType
+		}
+		if override.AccountType != "" {
+			cfg.AccountType = override.AccountType
+		}
+		if override.AccountNumber != "" {
+			cfg.AccountNumber = override.AccountNumber
+		}
+	}
+	pricing, err := usps.ParsePricing(cfg.MailClasses, cfg.PriceType, cfg.AccountType, cfg.AccountNumber)
+	pricing.Packaging = packaging
+	return pricing, errors.Join(append(errs, err)...)
+}
+
+// Breaker returns the circuit breaker guarding USPS rate requests, or nil
+// when the integration is disabled.
+func (s *USPSService) Breaker() *breaker.Breaker {
+	return s.breaker
+}
+
 // Enabled reports whether the direct USPS integration is active.
 func (s *USPSService) Enabled() bool {
 	return s.enabled
 }
 
-// GetRateQuotes gets shipping rate quotes from USPS
-func (s *USPSService) GetRateQuotes(req *models.ShipmentRequest) ([]models.Rate, error) {
+// Ping checks that a USPS OAuth token can be obtained. It returns
+// health.ErrDisabled when the direct integration is turned off.
+func (s *USPSService) Ping(ctx context.Context) error {
 	if !s.enabled {
-		return nil, nil
+		return health.ErrDisabled
+	}
+	return s.uspsClient.Authenticate(ctx)
+}
+
+// Validate checks the USPS-specific parts of a quote request: pricing
+// overrides, packaging and extra services. Extra services and the account
+// override are checked even while the integration is disabled, so a
+// request is accepted or rejected the same way either way. Public keys,
+// whose requests come from browsers, may not bill another USPS account.
+func (s *USPSService) Validate(ctx context.Context, req *models.ShipmentRequest) error {
+	_, err := extraServices(req)
+	errs := []error{err}
+	if req.USPS != nil && req.USPS.AccountNumber != "" && middleware.KeyPublic(ctx) {
+		errs = append(errs, errors.New("usps.account_number can't be set with a public API key"))
+	}
+	if s.enabled {
+		_, err := s.Pricing(req.USPS)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// extraServiceCodes maps request extra service names to USPS codes;
+// insurance is resolved separately since its code depends on the value.
+var extraServiceCodes = map[string]usps.ExtraService{
+	models.ExtraSignature:                usps.SignatureConfirmation,
+	models.ExtraAdultSignature:           usps.AdultSignatureRequired,
+	models.ExtraAdultSignatureRestricted: usps.AdultSignatureRestrictedDelivery,
+}
+
+// extraServices maps the extras a request asks for from USPS codes to their
+// request names.
+func extraServices(req *models.ShipmentRequest) (map[usps.ExtraService]string, error) {
+	extras := make(map[usps.ExtraService]string)
+	for _, name := range req.ExtraServices {
+		if name == models.ExtraInsurance {
+			if req.DeclaredValue() <= 0 {
+				return nil, errors.New("insurance needs insured_value or item values")
+			}
+			extras[usps.Insurance(req.DeclaredValue())] = name
+			continue
+		}
+		code, ok := extraServiceCodes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extra service %q", name)
+		}
+		extras[code] = name
+	}
+	signatures := 0
+	for _, code := range extraServiceCodes {
+		if _, ok := extras[code]; ok {
+			signatures++
+		}
 	}
+	if signatures > 1 {
+		return nil, errors.New("only one of signature, adult_signature and adult_signature_restricted may be requested")
+	}
+	return extras, nil
+}
+
+// GetRateQuotes gets shipping rate quotes from USPS. Warnings USPS attaches
+// to the requested extra services are returned alongside the rates.
+func (s *USPSService) GetRateQuotes(ctx context.Context, req *models.ShipmentRequest) (*models.ShipHawkResponse, error) {
+	if !s.enabled {
+		return &models.ShipHawkResponse{}, nil
+	}
+	pricing, err := s.Pricing(req.USPS)
+	if err != nil {
+		return nil, err
+	}
+	extras, err := extraServices(req)
+	if err != nil {
+		return nil, err
+	}
+	if !usps.IsDomestic(req.DestinationCountry()) {
+		return s.getInternationalRateQuotes(ctx, req, pricing, extras)
+	}
+
+	resp := &models.ShipHawkResponse{Rates: []models.Rate{}}
+	mailClasses := slices.DeleteFunc(slices.Clone(pricing.MailClasses), usps.MailClass.International)
+	if len(mailClasses) == 0 {
+		return resp, nil
+	}
+
 	// Convert ShipmentRequest to USPS RateRequest
 	uspsReq := usps.RateRequest{
-		FromZipCode: req.OriginZip,
-		ToZipCode:   req.DestinationZip,
-		MailClasses: []usps.MailClass{
-			usps.PriorityMail,
-			usps.GroundAdvantage,
-			usps.PriorityMailExpress,
-		},
-		PriceType:   usps.Commercial,
-		AccountType: usps.EPS,
+		FromZipCode:   req.OriginPostalCode(),
+		ToZipCode:     req.DestinationPostalCode(),
+		MailClasses:   mailClasses,
+		PriceType:     pricing.PriceType,
+		AccountType:   pricing.AccountType,
+		AccountNumber: pricing.AccountNumber,
+	}
+	if len(extras) > 0 {
+		uspsReq.ExtraServices = slices.Sorted(maps.Keys(extras))
+	}
+	if slices.Contains(req.ExtraServices, models.ExtraInsurance) {
+		uspsReq.ItemValue = req.DeclaredValue()
 	}
 
 	// Use the first package item for dimensions and weight
+	var parcel usps.Parcel
 	if len(req.Items) > 0 {
 		item := req.Items[0]
+		parcel = usps.Parcel{Length: item.Length, Width: item.Width, Height: item.Height, Weight: item.Weight}
 		uspsReq.Weight = item.Weight
 		uspsReq.Length = item.Length
 		uspsReq.Width = item.Width
 		uspsReq.Height = item.Height
 	}
 
-	// Get rates from USPS
-	uspsRates, err := s.uspsClient.GetRates(context.Background(), uspsReq)
+	uspsRates, err := s.search(ctx, func() (*usps.RateResponse, error) {
+		return s.uspsClient.GetRates(ctx, uspsReq)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get USPS rates: %w", err)
+		return nil, err
 	}
 
-	// Convert USPS rates to our Rate model
-	var rates []models.Rate
-	// Filter for only machinable rates
+	// Convert the rates that apply to this parcel to our Rate model
+	warnings := newWarningSet()
 	for _, rateOption := range uspsRates.RateOptions {
+		accepted := false
 		for _, rate := range rateOption.Rates {
-			// Skip non-machinable rates
-			if rate.ProcessingCategory != usps.Machinable ||
-				(rate.RateIndicator != usps.SinglePiece && rate.RateIndicator != usps.PriorityExpressSinglePiece) ||
-				rate.DestinationEntryFacilityType != usps.None {
+			if !parcel.Accepts(rate) {
 				continue
 			}
-			rate := models.Rate{
-				Carrier:             "USPS",
-				CarrierCode:         "USPS",
-				ServiceName:         rate.ProductName,
-				ServiceCode:         rate.Description,
-				StandardServiceName: standardizeServiceName(rate.ProductName),
-				RateDisplayName:     rate.ProductName,
-				Price:               fmt.Sprintf("%.2f", rate.Price),
-				CurrencyCode:        "USD",
-				ServiceDays:         serviceDays(rate),
-				EstDeliveryDate:     time.Now().AddDate(0, 0, serviceDays(rate)).Format("2006-01-02"),
-				RatesProvider:       "USPS",
+			resp.Rates = append(resp.Rates, toRate(rate, rateOption, extras, displayName(rate, parcel)))
+			accepted = true
+		}
+		if accepted {
+			warnings.add(rateOption, extras)
+		}
+	}
+
+	// Quote each requested container and merge its rates in. A container
+	// that fails to quote is reported as a warning rather than losing the
+	// rates already found. The APO/FPO/DPO box is only for military mail.
+	military := destination.Classify(req).Military
+	for _, packaging := range pricing.Packaging {
+		if !packaging.Fits(parcel) || packaging.MilitaryOnly() && !military {
+			continue
+		}
+		packagingRates, err := s.search(ctx, func() (*usps.RateResponse, error) {
+			return s.uspsClient.GetRates(ctx, packaging.Request(uspsReq))
+		})
+		if err != nil {
+			warnings.list = append(warnings.list, models.ShipHawkError{
+				Message:     fmt.Sprintf("%s: %v", packaging.Name, err),
+				CarrierName: "USPS",
+				CarrierCode: "usps",
+			})
+			continue
+		}
+		for _, rateOption := range packagingRates.RateOptions {
+			accepted := false
+			for _, rate := range rateOption.Rates {
+				if !packaging.Accepts(rate) {
+					continue
+				}
+				resp.Rates = append(resp.Rates, toRate(rate, rateOption, extras, rate.ProductName+" "+packaging.Name))
+				accepted = true
+			}
+			if accepted {
+				warnings.add(rateOption, extras)
 			}
-			rates = append(rates, rate)
 		}
 	}
 
-	return rates, nil
+	resp.Warnings = warnings.list
+	metrics.UpstreamRates.WithLabelValues("usps", "usps").Add(float64(len(resp.Rates)))
+	return resp, nil
+}
+
+// warningSet collects USPS extra service warnings, dropping repeats that
+// several rate options carry.
+type warningSet struct {
+	seen map[string]bool
+	list []models.ShipHawkError
+}
+
+func newWarningSet() *warningSet {
+	return &warningSet{seen: make(map[string]bool)}
+}
+
+// add records the warnings on option's requested extra services.
+func (w *warningSet) add(option usps.RateOption, extras map[usps.ExtraService]string) {
+	for _, extra := range option.ExtraServices {
+		if _, ok := extras[extra.Code()]; !ok {
+			continue
+		}
+		for _, warning := range extra.Warnings {
+			key := extra.ExtraService + "|" + warning.WarningCode + "|" + warning.WarningDescription
+			if w.seen[key] {
+				continue
+			}
+			w.seen[key] = true
+			w.list = append(w.list, models.ShipHawkError{
+				Message:     fmt.Sprintf("%s: %s", extra.Name, warning.WarningDescription),
+				CarrierName: "USPS",
+				CarrierCode: "usps",
+			})
+		}
+	}
+}
+
+// getInternationalRateQuotes quotes a foreign destination. Signature
+// services are domestic only, so they are dropped with a warning, as is
+// packaging. Insurance covers the declared customs value.
+func (s *USPSService) getInternationalRateQuotes(ctx context.Context, req *models.ShipmentRequest, pricing usps.Pricing, extras map[usps.ExtraService]string) (*models.ShipHawkResponse, error) {
+	resp := &models.ShipHawkResponse{Rates: []models.Rate{}}
+	mailClasses := slices.DeleteFunc(slices.Clone(pricing.MailClasses), func(m usps.MailClass) bool {
+		return !m.International()
+	})
+	if len(mailClasses) == 0 {
+		return resp, nil
+	}
+	warn := func(format string, args ...any) {
+		resp.Warnings = append(resp.Warnings, models.ShipHawkError{
+			Message:     fmt.Sprintf(format, args...),
+			CarrierName: "USPS",
+			CarrierCode: "usps",
+		})
+	}
+
+	intlExtras := make(map[usps.ExtraService]string)
+	for _, code := range slices.Sorted(maps.Keys(extras)) {
+		name := extras[code]
+		if name != models.ExtraInsurance {
+			warn("%s is not available for international USPS mail", name)
+			continue
+		}
+		intlExtras[code] = name
+	}
+	if len(pricing.Packaging) > 0 {
+		warn("USPS packaging is only quoted for domestic destinations")
+	}
+
+	uspsReq := usps.InternationalRateRequest{
+		FromZipCode:            req.OriginPostalCode(),
+		ForeignPostalCode:      req.DestinationPostalCode(),
+		DestinationCountryCode: strings.ToUpper(req.DestinationCountry()),
+		MailClasses:            mailClasses,
+		PriceType:              pricing.PriceType,
+		AccountType:            pricing.AccountType,
+		AccountNumber:          pricing.AccountNumber,
+		ItemValue:              req.DeclaredValue(),
+	}
+	if len(intlExtras) > 0 {
+		uspsReq.ExtraServices = slices.Sorted(maps.Keys(intlExtras))
+	}
+	if len(req.Items) > 0 {
+		item := req.Items[0]
+		uspsReq.Weight = item.Weight
+		uspsReq.Length = item.Length
+		uspsReq.Width = item.Width
+		uspsReq.Height = item.Height
+	}
+
+	// The international price search takes no customs item data, so HS
+	// codes can't be sent with it and don't affect the price. They are only
+	// checked here so a missing one is flagged before the customs form
+	// needs it.
+	for i, item := range req.Items {
+		if item.HSCode == "" {
+			name := item.Name
+			if name == "" {
+				name = fmt.Sprintf("item %d", i+1)
+			}
+			warn("%s has no HS code; one is required on the customs declaration", name)
+		}
+	}
+
+	uspsRates, err := s.search(ctx, func() (*usps.RateResponse, error) {
+		return s.uspsClient.GetInternationalRates(ctx, uspsReq)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := newWarningSet()
+	for _, rateOption := range uspsRates.RateOptions {
+		accepted := false
+		for _, rate := range rateOption.Rates {
+			if !usps.AcceptsInternational(rate) {
+				continue
+			}
+			resp.Rates = append(resp.Rates, toRate(rate, rateOption, intlExtras, rate.ProductName))
+			accepted = true
+		}
+		if accepted {
+			warnings.add(rateOption, intlExtras)
+		}
+	}
+	resp.Warnings = append(resp.Warnings, warnings.list...)
+	metrics.UpstreamRates.WithLabelValues("usps", "usps").Add(float64(len(resp.Rates)))
+	return resp, nil
+}
+
+// search runs a USPS rate search, failing fast while USPS is known to be
+// down.
+func (s *USPSService) search(ctx context.Context, call func() (*usps.RateResponse, error)) (*usps.RateResponse, error) {
+	done, err := s.breaker.Allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := call()
+	done(upstreamOutcome(ctx, err, 0))
+	if err != nil {
+		metrics.UpstreamErrors.WithLabelValues("usps", "usps").Inc()
+		return nil, fmt.Errorf("failed to get USPS rates: %w", err)
+	}
+	return resp, nil
+}
+
+// toRate converts a USPS rate to our Rate model, adding the rate's fees as
+// surcharges and pricing the requested extras from the rate's option.
+func toRate(rate usps.Rate, option usps.RateOption, extras map[usps.ExtraService]string, displayName string) models.Rate {
+	r := models.Rate{
+		Carrier:             "USPS",
+		CarrierCode:         "USPS",
+		ServiceName:         rate.ProductName,
+		ServiceCode:         rate.Description,
+		StandardServiceName: standardizeServiceName(rate.ProductName),
+		RateDisplayName:     displayName,
+		BasePrice:           fmt.Sprintf("%.2f", rate.Price),
+		CurrencyCode:        "USD",
+		ServiceDays:         serviceDays(rate),
+		EstDeliveryDate:     time.Now().AddDate(0, 0, serviceDays(rate)).Format("2006-01-02"),
+		RatesProvider:       "USPS",
+		RateIndicator:       string(rate.RateIndicator),
+	}
+
+	price := rate.Price
+	for _, fee := range rate.Fees {
+		r.Surcharges = append(r.Surcharges, models.Surcharge{
+			Code:        models.NormalizeSurchargeCode(fee.SKU, fee.Name),
+			CarrierCode: fee.SKU,
+			Description: fee.Name,
+			Amount:      models.Amount(fee.Price),
+		})
+		price += fee.Price
+	}
+	r.Price = fmt.Sprintf("%.2f", price)
+
+	total := price
+	for _, extra := range option.ExtraServices {
+		name, ok := extras[extra.Code()]
+		if !ok {
+			continue
+		}
+		r.ExtraServices = append(r.ExtraServices, models.ExtraServicePrice{
+			Service: name,
+			Code:    extra.ExtraService,
+			Name:    extra.Name,
+			Price:   extra.Price,
+		})
+		if name == models.ExtraInsurance {
+			r.InsurancePrice = extra.Price
+		}
+		total += extra.Price
+	}
+	r.TotalPrice = fmt.Sprintf("%.2f", total)
+	return r
+}
+
+// displayName tells cubic and non-machinable rates apart from the regular
+// single-piece rate for the same product.
+func displayName(rate usps.Rate, parcel usps.Parcel) string {
+	switch {
+	case rate.RateIndicator == usps.CubicParcel:
+		return fmt.Sprintf("%s Cubic (%.1f cu ft)", rate.ProductName, parcel.CubicTier())
+	case rate.ProcessingCategory == usps.NonMachinable:
+		return rate.ProductName + " (Nonmachinable)"
+	default:
+		return rate.ProductName
+	}
 }
 
 func serviceDays(rate usps.Rate) int {
@@ -115,6 +510,12 @@ func serviceDays(rate usps.Rate) int {
 		return 3
 	case "Priority Mail Express":
 		return 2
+	case "Priority Mail Express International":
+		return 5
+	case "Priority Mail International":
+		return 10
+	case "First-Class Package International Service":
+		return 15
 	default:
 		return 4
 	}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/fakeusps"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+)
+
+// newTestUSPSService starts a fake USPS server with the default fixtures,
+// wrapped by wrap if it isn't nil, and returns a service pointed at it.
+func newTestUSPSService(t *testing.T, wrap func(http.Handler) http.Handler) *USPSService {
+	t.Helper()
+	var handler http.Handler = fakeusps.New(fakeusps.Default(), fakeusps.Credentials{})
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	cfg := config.Defaults()
+	cfg.USPS.BaseURL = srv.URL
+	cfg.USPS.ConsumerKey = "test-key"
+	cfg.USPS.ConsumerSecret = "test-secret"
+	service, err := NewUSPSService(context.Background(), cfg, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// failRateIndicator fails rate searches for one rate indicator, such as a
+// single flat rate box.
+func failRateIndicator(indicator string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			var search struct {
+				RateIndicator string `json:"rateIndicator"`
+			}
+			if json.Unmarshal(body, &search) == nil && search.RateIndicator == indicator {
+				http.Error(w, `{"error":{"code":"500","message":"boom"}}`, http.StatusInternalServerError)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func uspsRequest(length, width, height, weight float64) *models.ShipmentRequest {
+	return &models.ShipmentRequest{
+		OriginZip:      "10001",
+		DestinationZip: "90210",
+		Items:          []models.PackageItem{{Length: length, Width: width, Height: height, Weight: weight, Qty: 1}},
+	}
+}
+
+// totals maps each rate's display name to its total price.
+func totals(resp *models.ShipHawkResponse) map[string]string {
+	got := make(map[string]string)
+	for _, r := range resp.Rates {
+		got[r.RateDisplayName] = r.TotalPrice
+	}
+	return got
+}
+
+func TestUSPSServiceGetRateQuotes(t *testing.T) {
+	tests := []struct {
+		name         string
+		req          func() *models.ShipmentRequest
+		wrap         func(http.Handler) http.Handler
+		want         map[string]string
+		wantWarnings []string
+	}{
+		{
+			name: "machinable with cubic tiers",
+			req:  func() *models.ShipmentRequest { return uspsRequest(10, 8, 6, 2) },
+			want: map[string]string{
+				"Priority Mail":                           "10.85",
+				"Priority Mail Cubic (0.3 cu ft)":         "9.12",
+				"USPS Ground Advantage":                   "8.40",
+				"USPS Ground Advantage Cubic (0.3 cu ft)": "7.05",
+				"Priority Mail Express":                   "38.75",
+			},
+		},
+		{
+			name: "nonmachinable adds the nonstandard fee",
+			req:  func() *models.ShipmentRequest { return uspsRequest(24, 10, 6, 5) },
+			want: map[string]string{
+				"Priority Mail (Nonmachinable)":         "18.25",
+				"USPS Ground Advantage (Nonmachinable)": "16.10",
+				"Priority Mail Express (Nonmachinable)": "42.30",
+			},
+		},
+		{
+			name: "cubic tier above Priority Mail's limit",
+			req:  func() *models.ShipmentRequest { return uspsRequest(16, 12, 8, 5) },
+			want: map[string]string{
+				"Priority Mail":                           "10.85",
+				"USPS Ground Advantage":                   "8.40",
+				"USPS Ground Advantage Cubic (0.9 cu ft)": "7.05",
+				"Priority Mail Express":                   "38.75",
+			},
+		},
+		{
+			name: "packaging the parcel fits",
+			req: func() *models.ShipmentRequest {
+				req := uspsRequest(10, 8, 6, 2)
+				req.USPS = &models.USPSOptions{
+					MailClasses: []string{"PRIORITY_MAIL"},
+					Packaging:   []string{"small_flat_rate_box", "medium_flat_rate_box", "flat_rate_envelope"},
+				}
+				return req
+			},
+			want: map[string]string{
+				"Priority Mail":                      "10.85",
+				"Priority Mail Cubic (0.3 cu ft)":    "9.12",
+				"Priority Mail Medium Flat Rate Box": "17.10",
+			},
+		},
+		{
+			name: "packaging search failure keeps other rates",
+			req: func() *models.ShipmentRequest {
+				req := uspsRequest(10, 8, 6, 2)
+				req.USPS = &models.USPSOptions{
+					MailClasses: []string{"PRIORITY_MAIL"},
+					Packaging:   []string{"medium_flat_rate_box", "large_flat_rate_box"},
+				}
+				return req
+			},
+			wrap: failRateIndicator("FB"),
+			want: map[string]string{
+				"Priority Mail":                     "10.85",
+				"Priority Mail Cubic (0.3 cu ft)":   "9.12",
+				"Priority Mail Large Flat Rate Box": "22.80",
+			},
+			wantWarnings: []string{"Medium Flat Rate Box: "},
+		},
+		{
+			name: "extras priced with warnings",
+			req: func() *models.ShipmentRequest {
+				req := uspsRequest(10, 8, 6, 2)
+				req.ExtraServices = []string{models.ExtraSignature, models.ExtraInsurance}
+				req.InsuredValue = 100
+				return req
+			},
+			want: map[string]string{
+				"Priority Mail":                           "17.15",
+				"Priority Mail Cubic (0.3 cu ft)":         "15.42",
+				"USPS Ground Advantage":                   "14.70",
+				"USPS Ground Advantage Cubic (0.3 cu ft)": "13.35",
+				"Priority Mail Express":                   "42.40",
+			},
+			wantWarnings: []string{"includes up to $100 of insurance"},
+		},
+		{
+			name: "international",
+			req: func() *models.ShipmentRequest {
+				req := uspsRequest(10, 8, 6, 2)
+				req.DestinationZip = "M5V 2T6"
+				req.DestinationCountryID = "CA"
+				req.Items[0].Value = 120
+				req.Items = append(req.Items, models.PackageItem{Name: "Shaker", HSCode: "392410", Weight: 1, Qty: 1})
+				req.ExtraServices = []string{models.ExtraSignature}
+				req.USPS = &models.USPSOptions{Packaging: []string{"small_flat_rate_box"}}
+				return req
+			},
+			want: map[string]string{
+				"Priority Mail International":               "52.30",
+				"First-Class Package International Service": "24.15",
+				"Priority Mail Express International":       "71.90",
+			},
+			wantWarnings: []string{
+				"signature is not available for international USPS mail",
+				"USPS packaging is only quoted for domestic destinations",
+				"item 1 has no HS code",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newTestUSPSService(t, tt.wrap)
+			resp, err := service.GetRateQuotes(context.Background(), tt.req())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := totals(resp); !maps.Equal(got, tt.want) {
+				t.Errorf("rates = %v, want %v", got, tt.want)
+			}
+			var warnings []string
+			for _, w := range resp.Warnings {
+				warnings = append(warnings, w.Message)
+			}
+			if len(warnings) != len(tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %d", warnings, len(tt.wantWarnings))
+			}
+			for _, want := range tt.wantWarnings {
+				if !slices.ContainsFunc(warnings, func(w string) bool { return strings.Contains(w, want) }) {
+					t.Errorf("warnings = %q, want one containing %q", warnings, want)
+				}
+			}
+		})
+	}
+}
+
+// recordRateIndicators notes the rate indicator of every rate search.
+func recordRateIndicators(indicators *[]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			var search struct {
+				RateIndicator string `json:"rateIndicator"`
+			}
+			if json.Unmarshal(body, &search) == nil && search.RateIndicator != "" {
+				*indicators = append(*indicators, search.RateIndicator)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestUSPSServiceMilitaryPackaging(t *testing.T) {
+	tests := []struct {
+		name           string
+		destinationZip string
+		want           []string
+	}{
+		{"civilian", "90210", []string{"PL"}},
+		{"APO", "09012", []string{"PL", "PM"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var indicators []string
+			service := newTestUSPSService(t, recordRateIndicators(&indicators))
+			req := uspsRequest(10, 8, 6, 2)
+			req.DestinationZip = tt.destinationZip
+			req.USPS = &models.USPSOptions{Packaging: []string{"large_flat_rate_box", "large_flat_rate_box_apo_fpo"}}
+			if _, err := service.GetRateQuotes(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(indicators, tt.want) {
+				t.Errorf("packaging searched = %v, want %v", indicators, tt.want)
+			}
+		})
+	}
+}
+
+func TestUSPSServiceNonstandardFee(t *testing.T) {
+	service := newTestUSPSService(t, nil)
+	resp, err := service.GetRateQuotes(context.Background(), uspsRequest(24, 10, 6, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(resp.Rates, func(r models.Rate) bool { return r.RateDisplayName == "Priority Mail (Nonmachinable)" })
+	if i < 0 {
+		t.Fatalf("rates = %v, want Priority Mail (Nonmachinable)", totals(resp))
+	}
+	rate := resp.Rates[i]
+	if rate.BasePrice != "14.25" || rate.Price != "18.25" {
+		t.Errorf("base price, price = %s, %s, want 14.25, 18.25", rate.BasePrice, rate.Price)
+	}
+	if len(rate.Surcharges) != 1 || rate.Surcharges[0].Code != models.SurchargeNonstandard || rate.Surcharges[0].Amount != 4 {
+		t.Errorf("surcharges = %+v, want the 4.00 nonstandard length fee", rate.Surcharges)
+	}
+}
@@ -0,0 +1,394 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cassette modes.
+const (
+	CassetteOff    = "off"
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// redactedValue replaces credentials in recorded exchanges.
+const redactedValue = "REDACTED"
+
+// redactedHeaders are never written to a cassette.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "Cookie", "Set-Cookie"}
+
+// redactedFields are form fields and top-level JSON keys masked in recorded
+// bodies: OAuth client secrets and the tokens issued for them.
+var redactedFields = []string{"client_secret", "access_token", "refresh_token", "id_token"}
+
+// Interaction is one recorded upstream exchange, stored as a JSON file under
+// <dir>/<provider>/. Bodies that are valid JSON are kept in Body so the file
+// is readable; anything else goes in RawBody.
+type Interaction struct {
+	Provider   string        `json:"provider"`
+	RecordedAt time.Time     `json:"recorded_at"`
+	Duration   Duration      `json:"duration"`
+	Request    RecordedEntry `json:"request"`
+	Response   RecordedEntry `json:"response"`
+}
+
+// RecordedEntry is the request or response half of an Interaction.
+type RecordedEntry struct {
+	Method  string          `json:"method,omitempty"`
+	URL     string          `json:"url,omitempty"`
+	Status  int             `json:"status,omitempty"`
+	Headers http.Header     `json:"headers,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+	RawBody string          `json:"raw_body,omitempty"`
+}
+
+// Duration is a time.Duration that reads and writes as a string like "1.2s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// body returns the recorded body bytes.
+func (e RecordedEntry) body() []byte {
+	if len(e.Body) > 0 {
+		return e.Body
+	}
+	return []byte(e.RawBody)
+}
+
+// setBody stores b in Body if it is JSON, otherwise in RawBody.
+func (e *RecordedEntry) setBody(b []byte) {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return
+	}
+	if json.Valid(b) {
+		e.Body = json.RawMessage(b)
+		return
+	}
+	e.RawBody = string(b)
+}
+
+// recorder writes every exchange passing through it to dir.
+type recorder struct {
+	provider string
+	dir      string
+	next     http.RoundTripper
+
+	mu  sync.Mutex
+	seq int
+}
+
+// Record returns a RoundTripper that forwards requests to next and writes
+// each exchange, with credentials redacted, to a JSON file under
+// dir/provider. Failing to write a cassette is logged, never returned.
+func Record(provider, dir string, next http.RoundTripper) http.RoundTripper {
+	return &recorder{provider: provider, dir: filepath.Join(dir, provider), next: next}
+}
+
+func (c *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Provider:   c.provider,
+		RecordedAt: start.UTC(),
+		Duration:   Duration(time.Since(start).Round(time.Millisecond)),
+		Request: RecordedEntry{
+			Method:  req.Method,
+			URL:     req.URL.Redacted(),
+			Headers: redactHeaders(req.Header),
+		},
+		Response: RecordedEntry{
+			Status:  resp.StatusCode,
+			Headers: redactHeaders(resp.Header),
+		},
+	}
+	interaction.Request.setBody(redactBody(reqBody))
+	interaction.Response.setBody(redactBody(respBody))
+
+	if err := c.write(&interaction); err != nil {
+		log.Printf("%s: failed to record %s %s: %v", c.provider, req.Method, req.URL.Path, err)
+	}
+	return resp, nil
+}
+
+func (c *recorder) write(interaction *Interaction) error {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.seq++
+	seq := c.seq
+	c.mu.Unlock()
+
+	// Timestamp first so files sort, and replay, in recording order
+	name := fmt.Sprintf("%s-%04d-%s-%s.json",
+		interaction.RecordedAt.Format("20060102T150405.000"), seq,
+		strings.ToLower(interaction.Request.Method), slug(interaction.Request.URL))
+	return os.WriteFile(filepath.Join(c.dir, name), data, 0o644)
+}
+
+// replayer answers requests from recorded interactions without touching the
+// network.
+type replayer struct {
+	provider string
+
+	mu     sync.Mutex
+	routes map[string][]*tape
+}
+
+// tape is a loaded interaction and whether it has been replayed yet.
+type tape struct {
+	interaction *Interaction
+	hash        string
+	played      bool
+}
+
+// Replay returns a RoundTripper that serves responses recorded under
+// dir/provider. A request gets the first unplayed recording with the same
+// method, path and redacted body; failing that, the next recording for the
+// same method and path, so quotes still replay once dates in the body have
+// moved on. When recordings run out the last match is served again.
+func Replay(provider, dir string) (http.RoundTripper, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("cassette directory %q does not exist", dir)
+	}
+	r := &replayer{provider: provider, routes: make(map[string][]*tape)}
+
+	files, err := filepath.Glob(filepath.Join(dir, provider, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", file, err)
+		}
+		u, err := url.Parse(interaction.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", file, err)
+		}
+		route := interaction.Request.Method + " " + u.Path
+		r.routes[route] = append(r.routes[route], &tape{
+			interaction: &interaction,
+			hash:        bodyHash(interaction.Request.body()),
+		})
+	}
+	return r, nil
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	route := req.Method + " " + req.URL.Path
+	hash := bodyHash(redactBody(reqBody))
+
+	r.mu.Lock()
+	t := r.match(route, hash)
+	r.mu.Unlock()
+	if t == nil {
+		return nil, fmt.Errorf("%s: no recorded response for %s", r.provider, route)
+	}
+	if t.hash != hash {
+		log.Printf("%s: no recording matches the body of %s, replaying %s", r.provider, route, t.interaction.RecordedAt.Format(time.RFC3339))
+	}
+
+	recorded := t.interaction.Response
+	header := recorded.Headers.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	// Redaction may have changed the body's length
+	header.Del("Content-Length")
+	body := recorded.body()
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// match picks the tape to replay for a request and marks it played.
+func (r *replayer) match(route, hash string) *tape {
+	tapes := r.routes[route]
+	var lastMatch *tape
+	for _, t := range tapes {
+		if t.hash != hash {
+			continue
+		}
+		if !t.played {
+			t.played = true
+			return t
+		}
+		lastMatch = t
+	}
+	if lastMatch != nil {
+		return lastMatch
+	}
+	for _, t := range tapes {
+		if !t.played {
+			t.played = true
+			return t
+		}
+	}
+	if len(tapes) > 0 {
+		return tapes[len(tapes)-1]
+	}
+	return nil
+}
+
+// readBody reads and restores the request body.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range redactedHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, redactedValue)
+		}
+	}
+	return out
+}
+
+// redactBody masks redactedFields in a JSON object or form-encoded body.
+// Other bodies are returned unchanged.
+func redactBody(b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err == nil {
+		changed := false
+		for _, field := range redactedFields {
+			if _, ok := obj[field]; ok {
+				obj[field] = json.RawMessage(`"` + redactedValue + `"`)
+				changed = true
+			}
+		}
+		if !changed {
+			return b
+		}
+		out, err := json.Marshal(obj)
+		if err != nil {
+			return b
+		}
+		return out
+	}
+	if json.Valid(b) {
+		return b
+	}
+	form, err := url.ParseQuery(string(b))
+	if err != nil {
+		return b
+	}
+	changed := false
+	for _, field := range redactedFields {
+		if form.Has(field) {
+			form.Set(field, redactedValue)
+			changed = true
+		}
+	}
+	if !changed {
+		return b
+	}
+	return []byte(form.Encode())
+}
+
+// bodyHash identifies a request body, ignoring JSON formatting.
+func bodyHash(b []byte) string {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, b); err == nil {
+		b = compact.Bytes()
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// slug turns a URL's path into a short file name fragment.
+func slug(rawURL string) string {
+	path := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		path = u.Path
+	}
+	s := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, path), "-")
+	if s == "" {
+		return "root"
+	}
+	return s
+}
@@ -0,0 +1,209 @@
+package transport
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// do sends a request through rt and returns the response body.
+func do(t *testing.T, rt http.RoundTripper, method, url, body string, header http.Header) (string, error) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), nil
+}
+
+// recordedFiles returns the contents of every cassette recorded for provider.
+func recordedFiles(t *testing.T, dir, provider string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, provider, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, string(data))
+	}
+	return contents
+}
+
+func TestRecordRedactsCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=cookie-secret")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"token-secret","token_type":"Bearer","expires_in":3600}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	rt := Record("usps", dir, http.DefaultTransport)
+	header := http.Header{
+		"Authorization": {"Bearer bearer-secret"},
+		"X-Api-Key":     {"key-secret"},
+		"Content-Type":  {"application/x-www-form-urlencoded"},
+	}
+	body, err := do(t, rt, http.MethodPost, srv.URL+"/oauth2/v3/token",
+		"grant_type=client_credentials&client_id=client-id&client_secret=client-secret", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "token-secret") {
+		t.Errorf("body = %s, want the caller to get the real token", body)
+	}
+
+	files := recordedFiles(t, dir, "usps")
+	if len(files) != 1 {
+		t.Fatalf("recorded %d files, want 1", len(files))
+	}
+	recorded := files[0]
+	for _, secret := range []string{"bearer-secret", "key-secret", "client-secret", "token-secret", "cookie-secret"} {
+		if strings.Contains(recorded, secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, recorded)
+		}
+	}
+	var interaction Interaction
+	if err := json.Unmarshal([]byte(recorded), &interaction); err != nil {
+		t.Fatal(err)
+	}
+	if got := interaction.Request.Headers.Get("X-Api-Key"); got != redactedValue {
+		t.Errorf("X-Api-Key = %q, want %q", got, redactedValue)
+	}
+	if !strings.Contains(interaction.Request.RawBody, "client_id=client-id") {
+		t.Errorf("request body = %q, want fields other than the secret kept", interaction.Request.RawBody)
+	}
+	var token map[string]any
+	if err := json.Unmarshal(interaction.Response.Body, &token); err != nil {
+		t.Fatal(err)
+	}
+	if token["access_token"] != redactedValue || token["token_type"] != "Bearer" {
+		t.Errorf("response body = %v, want only the token redacted", token)
+	}
+}
+
+// reply is what the rate server in TestReplay answers with.
+type reply struct {
+	Path string `json:"path"`
+	Zip  string `json:"zip"`
+}
+
+func TestReplay(t *testing.T) {
+	// Answer each rate request with the ZIP it asked about
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		var req struct {
+			Zip string `json:"zip"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		io.WriteString(w, `{"path":"`+r.URL.Path+`","zip":"`+req.Zip+`"}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	recorder := Record("shiphawk", dir, http.DefaultTransport)
+	for _, zip := range []string{"10001", "90210"} {
+		if _, err := do(t, recorder, http.MethodPost, srv.URL+"/api/v4/rates", `{"zip":"`+zip+`"}`, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := do(t, recorder, http.MethodGet, srv.URL+"/api/v4/carriers", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	recordedHits := hits.Load()
+
+	replayer, err := Replay("shiphawk", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		want    reply
+		wantErr bool
+	}{
+		{"matches the body, not the order", http.MethodPost, "/api/v4/rates", `{"zip":"90210"}`, reply{"/api/v4/rates", "90210"}, false},
+		{"ignores JSON formatting", http.MethodPost, "/api/v4/rates", "{ \"zip\": \"10001\" }", reply{"/api/v4/rates", "10001"}, false},
+		{"replays a match again", http.MethodPost, "/api/v4/rates", `{"zip":"10001"}`, reply{"/api/v4/rates", "10001"}, false},
+		{"matches on method and path", http.MethodGet, "/api/v4/carriers", "", reply{"/api/v4/carriers", ""}, false},
+		{"other method", http.MethodPut, "/api/v4/rates", `{"zip":"10001"}`, reply{}, true},
+		{"other path", http.MethodPost, "/api/v4/shipments", `{"zip":"10001"}`, reply{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := do(t, replayer, tt.method, srv.URL+tt.path, tt.body, nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("body = %s, want a replay miss", body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got reply
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("replayed %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if got := hits.Load(); got != recordedHits {
+		t.Errorf("server hit %d times during replay, want none", got-recordedHits)
+	}
+}
+
+func TestReplayFallsBackToRoute(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"rates":[]}`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	if _, err := do(t, Record("shiphawk", dir, http.DefaultTransport), http.MethodPost, srv.URL+"/api/v4/rates", `{"date":"2026-01-01"}`, nil); err != nil {
+		t.Fatal(err)
+	}
+	replayer, err := Replay("shiphawk", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dates in the body move on between recording and replay
+	body, err := do(t, replayer, http.MethodPost, srv.URL+"/api/v4/rates", `{"date":"2026-02-01"}`, nil)
+	if err != nil || !strings.Contains(body, `"rates"`) {
+		t.Errorf("body, error = %s, %v, want the recording for the route", body, err)
+	}
+}
+
+func TestReplayRequiresDirectory(t *testing.T) {
+	if _, err := Replay("shiphawk", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Replay() error = nil, want a missing directory reported")
+	}
+}
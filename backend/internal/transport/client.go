@@ -0,0 +1,154 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/config"
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
+)
+
+// Factory builds the HTTP clients injected into every upstream service. All
+// clients share one connection pool; each adds its provider's retry policy,
+// metrics and User-Agent on top. With cassettes enabled, each provider's
+// exchanges are recorded below those layers, or replayed in place of the
+// network.
+type Factory struct {
+	cfg       config.HTTPClientConfig
+	retry     config.RetryConfig
+	cassette  config.CassetteConfig
+	base      http.RoundTripper
+	replayers map[string]http.RoundTripper
+}
+
+// Option customizes a Factory.
+type Option func(*Factory)
+
+// WithRoundTripper replaces the shared network transport, e.g. with a stub
+// in tests. Retries, metrics and the User-Agent still apply on top of it.
+func WithRoundTripper(rt http.RoundTripper) Option {
+	return func(f *Factory) {
+		f.base = rt
+	}
+}
+
+// WithCassette records upstream exchanges to, or replays them from,
+// cfg.Dir according to cfg.Mode.
+func WithCassette(cfg config.CassetteConfig) Option {
+	return func(f *Factory) {
+		f.cassette = cfg
+	}
+}
+
+// NewFactory creates a Factory from the HTTP client and retry settings.
+func NewFactory(cfg config.HTTPClientConfig, retry config.RetryConfig, opts ...Option) (*Factory, error) {
+	f := &Factory{cfg: cfg, retry: retry}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.cassette.Mode == CassetteReplay {
+		if err := f.loadReplayers(); err != nil {
+			return nil, err
+		}
+	}
+	if f.base != nil {
+		return f, nil
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	f.base = &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+	}
+	return f, nil
+}
+
+// Client returns an HTTP client for the named provider.
+func (f *Factory) Client(provider string) *http.Client {
+	policy := RetryPolicy{
+		MaxAttempts: f.retry.MaxAttempts,
+		Budget:      f.retry.Budget,
+		BaseDelay:   f.retry.BaseDelay,
+		MaxDelay:    f.retry.MaxDelay,
+	}
+	base := f.base
+	switch f.cassette.Mode {
+	case CassetteRecord:
+		base = Record(provider, f.cassette.Dir, base)
+	case CassetteReplay:
+		base = f.replayers[provider]
+		if base == nil {
+			base = &replayer{provider: provider}
+		}
+	}
+	rt := Retry(provider, policy, metrics.Transport(provider, base))
+	if f.cfg.UserAgent != "" {
+		rt = userAgent(f.cfg.UserAgent, rt)
+	}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   f.cfg.Timeout,
+	}
+}
+
+// loadReplayers reads the recordings of every provider directory under the
+// cassette directory.
+func (f *Factory) loadReplayers() error {
+	entries, err := os.ReadDir(f.cassette.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cassette directory: %w", err)
+	}
+	f.replayers = make(map[string]http.RoundTripper)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		rt, err := Replay(entry.Name(), f.cassette.Dir)
+		if err != nil {
+			return err
+		}
+		f.replayers[entry.Name()] = rt
+	}
+	return nil
+}
+
+// userAgent sets the User-Agent header on requests that don't carry one.
+func userAgent(ua string, next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("User-Agent") == "" {
+			req = req.Clone(req.Context())
+			req.Header.Set("User-Agent", ua)
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
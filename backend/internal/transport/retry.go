@@ -0,0 +1,199 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/metrics"
+)
+
+// RetryPolicy controls how failed upstream requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first.
+	MaxAttempts int
+	// Budget caps the total time spent on a request across all attempts and
+	// the waits between them. Zero means no cap beyond the request context.
+	Budget time.Duration
+	// BaseDelay and MaxDelay bound the exponential backoff; each wait is
+	// drawn uniformly from [0, min(MaxDelay, BaseDelay*2^n)).
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Retry returns a RoundTripper that retries requests to provider through next.
+//
+// GET and HEAD requests are retried on any transport error, 429 and 5xx.
+// Other requests (our ShipHawk and USPS rate POSTs, and the OAuth token POST)
+// are quotes with no side effects, so they are retried on 429 and 5xx too,
+// but on transport errors only when the connection was never established.
+// A Retry-After header on 429/503 overrides the computed backoff.
+func Retry(provider string, policy RetryPolicy, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &retryTransport{provider: provider, policy: policy, next: next}
+}
+
+type retryTransport struct {
+	provider string
+	policy   RetryPolicy
+	next     http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	var deadline time.Time
+	if t.policy.Budget > 0 {
+		// The budget bounds the attempts themselves as well as the waits
+		// between them. The response body is read after we return, so the
+		// context is only released once the caller closes it.
+		ctx, cancel := context.WithTimeout(req.Context(), t.policy.Budget)
+		deadline, _ = ctx.Deadline()
+		req = req.WithContext(ctx)
+		defer func() {
+			if resp == nil {
+				cancel()
+				return
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+		}()
+	}
+
+	attempt := 0
+	defer func() {
+		metrics.UpstreamAttempts.WithLabelValues(t.provider, req.URL.Path).Observe(float64(attempt))
+	}()
+
+	for {
+		attempt++
+		if attempt > 1 && req.Body != nil {
+			// Bodies are consumed by each attempt; rewind before retrying.
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err = t.next.RoundTrip(req)
+
+		retry, reason := t.shouldRetry(req, resp, err)
+		if !retry || attempt >= t.policy.MaxAttempts {
+			switch {
+			case retry:
+				log.Printf("%s %s %s: attempt %d failed (%s), giving up", t.provider, req.Method, req.URL.Path, attempt, reason)
+			case attempt > 1:
+				log.Printf("%s %s %s: succeeded on attempt %d", t.provider, req.Method, req.URL.Path, attempt)
+			}
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				wait = after
+			}
+		}
+		if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+			log.Printf("%s %s %s: attempt %d failed (%s), retry budget exhausted", t.provider, req.Method, req.URL.Path, attempt, reason)
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		log.Printf("%s %s %s: attempt %d/%d failed (%s), retrying in %s",
+			t.provider, req.Method, req.URL.Path, attempt, t.policy.MaxAttempts, reason, wait.Round(time.Millisecond))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// cancelBody releases the budget's context once the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// shouldRetry decides whether an attempt's outcome is worth retrying and
+// describes it for the logs.
+func (t *retryTransport) shouldRetry(req *http.Request, resp *http.Response, err error) (bool, string) {
+	if req.Body != nil && req.GetBody == nil {
+		return false, ""
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false, ""
+		}
+		idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+		return idempotent || isConnectError(err), err.Error()
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return true, "status " + strconv.Itoa(resp.StatusCode)
+	}
+	return false, ""
+}
+
+// backoff returns a full-jitter exponential delay for the given attempt.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	if t.policy.BaseDelay <= 0 {
+		return 0
+	}
+	ceiling := t.policy.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || (t.policy.MaxDelay > 0 && ceiling > t.policy.MaxDelay) {
+		ceiling = t.policy.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+// isConnectError reports whether err happened before the request could have
+// reached the server, making it safe to retry any method.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,202 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport counts the attempts that reach the network.
+type countingTransport struct {
+	calls atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// statusSequence answers with each status in turn, repeating the last.
+func statusSequence(statuses ...int) http.HandlerFunc {
+	var n atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		i := min(int(n.Add(1)), len(statuses)) - 1
+		if statuses[i] == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(statuses[i])
+		io.WriteString(w, "ok")
+	}
+}
+
+// hangUpOnce drops the connection of the first request without answering.
+func hangUpOnce() http.HandlerFunc {
+	var n atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) == 1 {
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		io.WriteString(w, "ok")
+	}
+}
+
+var testPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		method     string
+		body       func() io.Reader
+		policy     RetryPolicy
+		wantCalls  int32
+		wantStatus int // 0 for a transport error
+	}{
+		{"5xx then success", statusSequence(502, 200), http.MethodPost, nil, testPolicy, 2, 200},
+		{"429 then success", statusSequence(429, 200), http.MethodGet, nil, testPolicy, 2, 200},
+		{"4xx", statusSequence(400, 200), http.MethodPost, nil, testPolicy, 1, 400},
+		{"max attempts", statusSequence(503), http.MethodPost, nil, RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond}, 4, 503},
+		{"replayable POST body", statusSequence(500, 200), http.MethodPost, func() io.Reader { return strings.NewReader("{}") }, testPolicy, 2, 200},
+		{
+			name:    "POST body that can't be replayed",
+			handler: statusSequence(500, 200),
+			method:  http.MethodPost,
+			// Only bytes and strings readers get a GetBody from NewRequest
+			body:       func() io.Reader { return io.MultiReader(strings.NewReader("{}")) },
+			policy:     testPolicy,
+			wantCalls:  1,
+			wantStatus: 500,
+		},
+		{"dropped connection on GET", hangUpOnce(), http.MethodGet, nil, testPolicy, 2, 200},
+		{"dropped connection on POST", hangUpOnce(), http.MethodPost, nil, testPolicy, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			var body io.Reader
+			if tt.body != nil {
+				body = tt.body()
+			}
+			req, err := http.NewRequest(tt.method, srv.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next := &countingTransport{}
+			resp, err := Retry("test", tt.policy, next).RoundTrip(req)
+			if tt.wantStatus == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("status = %d, want a transport error", resp.StatusCode)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+				}
+			}
+			if got := next.calls.Load(); got != tt.wantCalls {
+				t.Errorf("attempts = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryConnectionRefused(t *testing.T) {
+	// Nothing listens on a closed server's address, so every dial fails
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &countingTransport{}
+	_, err = Retry("test", testPolicy, next).RoundTrip(req)
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("error = %v, want the dial error", err)
+	}
+	if got := next.calls.Load(); got != 3 {
+		t.Errorf("attempts = %d, want POSTs retried when the connection was never made", got)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Run("bounds a hung attempt", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+		defer srv.Close()
+		defer close(release)
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		policy := testPolicy
+		policy.Budget = 50 * time.Millisecond
+		start := time.Now()
+		_, err := Retry("test", policy, &countingTransport{}).RoundTrip(req)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want the budget's deadline", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("request took %s, want it cut off by the 50ms budget", elapsed)
+		}
+	})
+
+	t.Run("skips a wait past the budget", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		policy := testPolicy
+		policy.Budget = time.Second
+		next := &countingTransport{}
+		resp, err := Retry("test", policy, next).RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable || next.calls.Load() != 1 {
+			t.Errorf("status %d after %d attempts, want the first 503 returned", resp.StatusCode, next.calls.Load())
+		}
+	})
+
+	t.Run("leaves the body readable", func(t *testing.T) {
+		srv := httptest.NewServer(statusSequence(200))
+		defer srv.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		policy := testPolicy
+		policy.Budget = time.Second
+		resp, err := Retry("test", policy, &countingTransport{}).RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil || string(body) != "ok" {
+			t.Errorf("body = %q, %v, want ok", body, err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+// Package units converts package weights and dimensions to the pounds and
+// inches every provider integration works in. Requests are normalized once,
+// before any provider mapping, so storefronts can quote in metric units.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+)
+
+// WeightUnit is a unit of weight.
+type WeightUnit string
+
+// Weight units. Pound is what requests are normalized to.
+const (
+	Pound    WeightUnit = "lbs"
+	Ounce    WeightUnit = "oz"
+	Kilogram WeightUnit = "kg"
+	Gram     WeightUnit = "g"
+)
+
+// LengthUnit is a unit of length.
+type LengthUnit string
+
+// Length units. Inch is what requests are normalized to.
+const (
+	Inch       LengthUnit = "in"
+	Centimeter LengthUnit = "cm"
+)
+
+// poundsPer and inchesPer convert one of each unit.
+var (
+	poundsPer = map[WeightUnit]float64{
+		Pound:    1,
+		Ounce:    1.0 / 16,
+		Kilogram: 2.20462262185,
+		Gram:     0.00220462262185,
+	}
+	inchesPer = map[LengthUnit]float64{
+		Inch:       1,
+		Centimeter: 1 / 2.54,
+	}
+)
+
+// weightAliases and lengthAliases are the accepted spellings of each unit.
+var (
+	weightAliases = map[string]WeightUnit{
+		"lb": Pound, "lbs": Pound, "pound": Pound, "pounds": Pound,
+		"oz": Ounce, "ounce": Ounce, "ounces": Ounce,
+		"kg": Kilogram, "kgs": Kilogram, "kilogram": Kilogram, "kilograms": Kilogram,
+		"g": Gram, "gram": Gram, "grams": Gram,
+	}
+	lengthAliases = map[string]LengthUnit{
+		"in": Inch, "inch": Inch, "inches": Inch,
+		"cm": Centimeter, "centimeter": Centimeter, "centimeters": Centimeter,
+	}
+)
+
+// ParseWeightUnit parses a weight unit such as "lb", "lbs", "oz", "kg" or
+// "g". An empty string means pounds.
+func ParseWeightUnit(s string) (WeightUnit, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return Pound, nil
+	}
+	if u, ok := weightAliases[s]; ok {
+		return u, nil
+	}
+	return "", fmt.Errorf("unknown weight unit %q (use lb, oz, kg or g)", s)
+}
+
+// ParseLengthUnit parses a dimension unit, "in" or "cm". An empty string
+// means inches.
+func ParseLengthUnit(s string) (LengthUnit, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return Inch, nil
+	}
+	if u, ok := lengthAliases[s]; ok {
+		return u, nil
+	}
+	return "", fmt.Errorf("unknown dimension unit %q (use in or cm)", s)
+}
+
+// Pounds converts a weight to pounds.
+func Pounds(weight float64, unit WeightUnit) float64 {
+	return round(weight * poundsPer[unit])
+}
+
+// Inches converts a length to inches.
+func Inches(length float64, unit LengthUnit) float64 {
+	return round(length * inchesPer[unit])
+}
+
+// round drops floating point noise, so 30.48 cm is 12 inches rather than
+// 11.999999, which matters when sides are rounded down for cubic pricing.
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// Normalize converts every item in the request to pounds and inches in
+// place and sets its units accordingly. Items with unknown units are
+// reported together and the request is left unchanged.
+func Normalize(req *models.ShipmentRequest) error {
+	var errs []error
+	weightUnits := make([]WeightUnit, len(req.Items))
+	lengthUnits := make([]LengthUnit, len(req.Items))
+	for i, item := range req.Items {
+		var err error
+		if weightUnits[i], err = ParseWeightUnit(item.WeightUOM); err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %w", i+1, err))
+		}
+		if lengthUnits[i], err = ParseLengthUnit(item.DimensionUOM); err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %w", i+1, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for i := range req.Items {
+		item := &req.Items[i]
+		item.Weight = Pounds(item.Weight, weightUnits[i])
+		item.Length = Inches(item.Length, lengthUnits[i])
+		item.Width = Inches(item.Width, lengthUnits[i])
+		item.Height = Inches(item.Height, lengthUnits[i])
+		item.WeightUOM = string(Pound)
+		item.DimensionUOM = string(Inch)
+	}
+	return nil
+}
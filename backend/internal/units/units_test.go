@@ -0,0 +1,132 @@
+package units
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/muscleandstrength/GoShiphawkRates/internal/models"
+)
+
+func TestParseWeightUnit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want WeightUnit
+	}{
+		{"", Pound},
+		{"  ", Pound},
+		{"lb", Pound},
+		{"LBS", Pound},
+		{" Pounds ", Pound},
+		{"oz", Ounce},
+		{"Ounce", Ounce},
+		{"KG", Kilogram},
+		{"kilograms", Kilogram},
+		{"g", Gram},
+		{" grams\t", Gram},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseWeightUnit(tt.in)
+			if err != nil || got != tt.want {
+				t.Errorf("ParseWeightUnit(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+	if _, err := ParseWeightUnit("stone"); err == nil {
+		t.Error(`ParseWeightUnit("stone") error = nil, want unknown unit`)
+	}
+}
+
+func TestParseLengthUnit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want LengthUnit
+	}{
+		{"", Inch},
+		{"in", Inch},
+		{" INCHES ", Inch},
+		{"cm", Centimeter},
+		{"Centimeters", Centimeter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLengthUnit(tt.in)
+			if err != nil || got != tt.want {
+				t.Errorf("ParseLengthUnit(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+			}
+		})
+	}
+	if _, err := ParseLengthUnit("mm"); err == nil {
+		t.Error(`ParseLengthUnit("mm") error = nil, want unknown unit`)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	weights := []struct {
+		weight float64
+		unit   WeightUnit
+		want   float64
+	}{
+		{2, Pound, 2},
+		{8, Ounce, 0.5},
+		{1, Kilogram, 2.204623},
+		{500, Gram, 1.102311},
+	}
+	for _, tt := range weights {
+		if got := Pounds(tt.weight, tt.unit); got != tt.want {
+			t.Errorf("Pounds(%v, %s) = %v, want %v", tt.weight, tt.unit, got, tt.want)
+		}
+	}
+	// Exactly 12, not 11.999999, so cubic tiers round down correctly
+	if got := Inches(30.48, Centimeter); got != 12 {
+		t.Errorf("Inches(30.48, cm) = %v, want 12", got)
+	}
+	if got := Inches(10, Inch); got != 10 {
+		t.Errorf("Inches(10, in) = %v, want 10", got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	req := &models.ShipmentRequest{Items: []models.PackageItem{
+		{Weight: 2, Length: 10, Width: 8, Height: 6},
+		{Weight: 1, WeightUOM: "KG", Length: 30.48, Width: 20.32, Height: 15.24, DimensionUOM: " cm "},
+		{Weight: 4, WeightUOM: "oz"},
+	}}
+	if err := Normalize(req); err != nil {
+		t.Fatal(err)
+	}
+	want := []models.PackageItem{
+		{Weight: 2, Length: 10, Width: 8, Height: 6, WeightUOM: "lbs", DimensionUOM: "in"},
+		{Weight: 2.204623, Length: 12, Width: 8, Height: 6, WeightUOM: "lbs", DimensionUOM: "in"},
+		{Weight: 0.25, WeightUOM: "lbs", DimensionUOM: "in"},
+	}
+	if !reflect.DeepEqual(req.Items, want) {
+		t.Errorf("items = %+v, want %+v", req.Items, want)
+	}
+}
+
+func TestNormalizeUnknownUnits(t *testing.T) {
+	req := &models.ShipmentRequest{Items: []models.PackageItem{
+		{Weight: 1, WeightUOM: "kg", Length: 10, DimensionUOM: "cm"},
+		{Weight: 2, WeightUOM: "stone"},
+		{Weight: 3, Length: 4, DimensionUOM: "furlongs"},
+	}}
+	before := append([]models.PackageItem(nil), req.Items...)
+
+	err := Normalize(req)
+	if err == nil {
+		t.Fatal("Normalize() error = nil, want the unknown units")
+	}
+	for _, want := range []string{`item 2: unknown weight unit "stone"`, `item 3: unknown dimension unit "furlongs"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %q, want it to contain %q", err, want)
+		}
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); !ok || len(joined.Unwrap()) != 2 {
+		t.Errorf("error = %#v, want both problems joined", err)
+	}
+	if !reflect.DeepEqual(req.Items, before) {
+		t.Errorf("items = %+v, want the request left unchanged %+v", req.Items, before)
+	}
+}
@@ -1,48 +1,92 @@
 package usps
 
 import (
-	"os"
-
-	"github.com/joho/godotenv"
+	"errors"
+	"net/http"
+	"slices"
 )
 
+// DefaultBaseURL is the production USPS APIs host.
+const DefaultBaseURL = "https://apis.usps.com"
+
 // Config holds all configuration values
 type Config struct {
 	USPSConsumerKey    string
 	USPSConsumerSecret string
 	USPSBaseURL        string
-}
 
-func LoadUSPSConfig() (*Config, error) {
-	// Load .env file if it exists
-	_ = godotenv.Load()
+	// HTTPClient carries both token and rate requests. It defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+}
 
-	config := &Config{
-		USPSConsumerKey:    os.Getenv("USPS_CONSUMER_KEY"),
-		USPSConsumerSecret: os.Getenv("USPS_CONSUMER_SECRET"),
-		USPSBaseURL:        os.Getenv("USPS_BASE_URL"),
+// Validate checks that the required credentials are present.
+func (c Config) Validate() error {
+	if c.USPSConsumerKey == "" {
+		return ErrMissingConsumerKey
 	}
-
-	if config.USPSConsumerKey == "" {
-		return nil, ErrMissingConsumerKey
+	if c.USPSConsumerSecret == "" {
+		return ErrMissingConsumerSecret
 	}
+	return nil
+}
 
-	if config.USPSConsumerSecret == "" {
-		return nil, ErrMissingConsumerSecret
-	}
+// Pricing selects which USPS prices a rate request asks for.
+type Pricing struct {
+	MailClasses   []MailClass
+	PriceType     PriceType
+	AccountType   AccountType
+	AccountNumber string
 
-	// Set default values
-	if config.USPSBaseURL == "" {
-		config.USPSBaseURL = "https://apis.usps.com"
-	}
+	// Packaging lists containers to quote alongside the custom parcel
+	Packaging []Packaging
+}
 
-	return config, nil
+// ParsePricing builds Pricing from configuration or request strings. Empty
+// price and account types are left for USPS to default.
+func ParsePricing(mailClasses []string, priceType, accountType, accountNumber string) (Pricing, error) {
+	var p Pricing
+	var errs []error
+	if len(mailClasses) == 0 {
+		errs = append(errs, &ConfigError{"at least one USPS mail class is required"})
+	}
+	for _, name := range mailClasses {
+		class, err := ParseMailClass(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !slices.Contains(p.MailClasses, class) {
+			p.MailClasses = append(p.MailClasses, class)
+		}
+	}
+	if priceType != "" {
+		var err error
+		if p.PriceType, err = ParsePriceType(priceType); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if accountType != "" {
+		var err error
+		if p.AccountType, err = ParseAccountType(accountType); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if accountNumber != "" && p.AccountType == "" {
+		errs = append(errs, &ConfigError{"a USPS account number needs an account type (EPS or CPP)"})
+	}
+	p.AccountNumber = accountNumber
+	return p, errors.Join(errs...)
 }
 
 // Errors
 var (
-	ErrMissingConsumerKey    = &ConfigError{"USPS_CONSUMER_KEY environment variable is required"}
-	ErrMissingConsumerSecret = &ConfigError{"USPS_CONSUMER_SECRET environment variable is required"}
+	ErrMissingConsumerKey    = &ConfigError{"USPS consumer key is required (USPS_CONSUMER_KEY or usps.consumer_key)"}
+	ErrMissingConsumerSecret = &ConfigError{"USPS consumer secret is required (USPS_CONSUMER_SECRET or usps.consumer_secret)"}
+
+	// ErrInvalidCredentials is returned when the USPS token endpoint rejects
+	// the consumer key and secret.
+	ErrInvalidCredentials = errors.New("USPS rejected the consumer key/secret")
 )
 
 type ConfigError struct {
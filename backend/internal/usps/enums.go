@@ -1,15 +1,27 @@
 package usps
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
 // MailClass represents the USPS mail class types
 type MailClass string
 
 const (
 	PriorityMail        MailClass = "PRIORITY_MAIL"
 	GroundAdvantage     MailClass = "USPS_GROUND_ADVANTAGE"
-	FirstClassPackage   MailClass = "FIRST_CLASS_PACKAGE"
 	PriorityMailExpress MailClass = "PRIORITY_MAIL_EXPRESS"
+
+	// FirstClassPackage was folded into Ground Advantage in July 2023; USPS
+	// still accepts it but may return no rates.
+	FirstClassPackage MailClass = "FIRST-CLASS_PACKAGE_SERVICE"
 )
 
+// MailClasses lists the domestic mail classes a rate request may ask for.
+var MailClasses = []MailClass{PriorityMail, GroundAdvantage, FirstClassPackage, PriorityMailExpress}
+
 // PriceType represents the USPS price types
 type PriceType string
 
@@ -18,6 +30,9 @@ const (
 	Retail     PriceType = "RETAIL"
 )
 
+// PriceTypes lists the accepted price types.
+var PriceTypes = []PriceType{Commercial, Retail}
+
 // AccountType represents the USPS account types
 type AccountType string
 
@@ -26,6 +41,9 @@ const (
 	CPP AccountType = "CPP"
 )
 
+// AccountTypes lists the accepted account types.
+var AccountTypes = []AccountType{EPS, CPP}
+
 // ProcessingCategory represents the USPS processing categories
 type ProcessingCategory string
 
@@ -41,6 +59,15 @@ const (
 	SinglePiece                RateIndicator = "SP"
 	PriorityExpressSinglePiece RateIndicator = "PA"
 	CubicParcel                RateIndicator = "CP"
+
+	// Flat rate containers
+	FlatRateEnvelope       RateIndicator = "FE"
+	LegalFlatRateEnvelope  RateIndicator = "FA"
+	PaddedFlatRateEnvelope RateIndicator = "FP"
+	SmallFlatRateBox       RateIndicator = "FS"
+	MediumFlatRateBox      RateIndicator = "FB"
+	LargeFlatRateBox       RateIndicator = "PL"
+	LargeFlatRateBoxAPOFPO RateIndicator = "PM"
 )
 
 // DestinationEntryFacilityType represents the USPS destination entry facility types
@@ -55,3 +82,54 @@ const (
 	MixedDSCF DestinationEntryFacilityType = "MIXED_DSCF"
 	MixedDDU  DestinationEntryFacilityType = "MIXED_DDU"
 )
+
+// ExtraService is a USPS extra service code
+type ExtraService int
+
+const (
+	SignatureConfirmation            ExtraService = 921
+	AdultSignatureRequired           ExtraService = 922
+	AdultSignatureRestrictedDelivery ExtraService = 923
+	InsuranceUpTo500                 ExtraService = 930
+	InsuranceOver500                 ExtraService = 931
+)
+
+// insuranceTierLimit is the declared value above which InsuranceOver500
+// applies.
+const insuranceTierLimit = 500.0
+
+// Insurance returns the insurance extra service for a declared value.
+func Insurance(value float64) ExtraService {
+	if value > insuranceTierLimit {
+		return InsuranceOver500
+	}
+	return InsuranceUpTo500
+}
+
+// ParseMailClass parses a domestic or international mail class name
+// case-insensitively.
+func ParseMailClass(s string) (MailClass, error) {
+	return parseEnum("mail class", s, slices.Concat(MailClasses, InternationalMailClasses))
+}
+
+// ParsePriceType parses a price type case-insensitively.
+func ParsePriceType(s string) (PriceType, error) {
+	return parseEnum("price type", s, PriceTypes)
+}
+
+// ParseAccountType parses an account type case-insensitively.
+func ParseAccountType(s string) (AccountType, error) {
+	return parseEnum("account type", s, AccountTypes)
+}
+
+func parseEnum[T ~string](kind, s string, valid []T) (T, error) {
+	v := T(strings.ToUpper(strings.TrimSpace(s)))
+	if slices.Contains(valid, v) {
+		return v, nil
+	}
+	names := make([]string, len(valid))
+	for i, name := range valid {
+		names[i] = string(name)
+	}
+	return "", &ConfigError{fmt.Sprintf("unknown USPS %s %q (want one of %s)", kind, s, strings.Join(names, ", "))}
+}
@@ -0,0 +1,70 @@
+package usps
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// International mail classes
+const (
+	PriorityMailInternational        MailClass = "PRIORITY_MAIL_INTERNATIONAL"
+	FirstClassPackageInternational   MailClass = "FIRST-CLASS_PACKAGE_INTERNATIONAL_SERVICE"
+	PriorityMailExpressInternational MailClass = "PRIORITY_MAIL_EXPRESS_INTERNATIONAL"
+)
+
+// InternationalMailClasses lists the mail classes quoted for foreign
+// destinations.
+var InternationalMailClasses = []MailClass{PriorityMailInternational, FirstClassPackageInternational, PriorityMailExpressInternational}
+
+// International reports whether the mail class only serves foreign
+// destinations.
+func (m MailClass) International() bool {
+	return slices.Contains(InternationalMailClasses, m)
+}
+
+// domesticCountries are the country codes USPS delivers as domestic mail:
+// the US itself, the territories that have their own ISO codes and the
+// freely associated states.
+var domesticCountries = []string{"", "US", "USA", "PR", "GU", "VI", "AS", "MP", "FM", "MH", "PW"}
+
+// IsDomestic reports whether a destination country code is served by the
+// domestic price search. An empty code means the US.
+func IsDomestic(country string) bool {
+	return slices.Contains(domesticCountries, strings.ToUpper(strings.TrimSpace(country)))
+}
+
+// InternationalRateRequest is the request for an international rate quote.
+// Weight is in pounds and dimensions in inches; ItemValue is the declared
+// customs value in USD. USPS prices international mail without customs item
+// details, so HS codes and item descriptions have no place here.
+type InternationalRateRequest struct {
+	FromZipCode            string         `json:"originZIPCode"`
+	ForeignPostalCode      string         `json:"foreignPostalCode,omitempty"`
+	DestinationCountryCode string         `json:"destinationCountryCode"`
+	Weight                 float64        `json:"weight"`
+	Length                 float64        `json:"length"`
+	Width                  float64        `json:"width"`
+	Height                 float64        `json:"height"`
+	MailClasses            []MailClass    `json:"mailClasses,omitempty"`
+	PriceType              PriceType      `json:"priceType,omitempty"`
+	MailingDate            string         `json:"mailingDate,omitempty"`
+	AccountType            AccountType    `json:"accountType,omitempty"`
+	AccountNumber          string         `json:"accountNumber,omitempty"`
+	ItemValue              float64        `json:"itemValue,omitempty"`
+	ExtraServices          []ExtraService `json:"extraServices,omitempty"`
+}
+
+// GetInternationalRates retrieves shipping rates to a foreign destination.
+// The response has the same layout as a domestic search.
+func (s *RateService) GetInternationalRates(ctx context.Context, req InternationalRateRequest) (*RateResponse, error) {
+	return s.search(ctx, "/international-prices/v3/total-rates/search", req)
+}
+
+// AcceptsInternational reports whether an international rate applies to a
+// custom parcel; flat rate container rates are left out.
+func AcceptsInternational(rate Rate) bool {
+	return !slices.ContainsFunc(Packagings, func(p Packaging) bool {
+		return p.RateIndicator == rate.RateIndicator
+	})
+}
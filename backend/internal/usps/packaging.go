@@ -0,0 +1,87 @@
+package usps
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Packaging is a USPS-supplied container priced by its rate indicator
+// rather than by the parcel's size. Dimensions are the container's interior,
+// in inches.
+type Packaging struct {
+	Code          string
+	Name          string
+	RateIndicator RateIndicator
+	MailClasses   []MailClass
+	Length        float64
+	Width         float64
+	Height        float64
+}
+
+// flatRateMaxWeight is the weight limit of every flat rate container.
+const flatRateMaxWeight = 70.0
+
+// Packagings lists the containers a quote request may ask for. Regional Rate
+// Boxes A and B are not here: USPS retired them in 2021 and no longer
+// prices them.
+var Packagings = []Packaging{
+	{"flat_rate_envelope", "Flat Rate Envelope", FlatRateEnvelope, []MailClass{PriorityMail, PriorityMailExpress}, 12.5, 9.5, 0.75},
+	{"legal_flat_rate_envelope", "Legal Flat Rate Envelope", LegalFlatRateEnvelope, []MailClass{PriorityMail, PriorityMailExpress}, 15, 9.5, 0.75},
+	{"padded_flat_rate_envelope", "Padded Flat Rate Envelope", PaddedFlatRateEnvelope, []MailClass{PriorityMail, PriorityMailExpress}, 12.5, 9.5, 1},
+	{"small_flat_rate_box", "Small Flat Rate Box", SmallFlatRateBox, []MailClass{PriorityMail}, 8.625, 5.375, 1.625},
+	{"medium_flat_rate_box", "Medium Flat Rate Box", MediumFlatRateBox, []MailClass{PriorityMail}, 11.25, 8.75, 6},
+	{"large_flat_rate_box", "Large Flat Rate Box", LargeFlatRateBox, []MailClass{PriorityMail}, 12.25, 12.25, 6},
+	{"large_flat_rate_box_apo_fpo", "Large Flat Rate Box APO/FPO/DPO", LargeFlatRateBoxAPOFPO, []MailClass{PriorityMail}, 12.25, 12.25, 6},
+}
+
+// LookupPackaging finds a container by its code, case-insensitively.
+func LookupPackaging(code string) (Packaging, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	for _, p := range Packagings {
+		if p.Code == code {
+			return p, nil
+		}
+	}
+	if strings.HasPrefix(code, "regional_rate") {
+		return Packaging{}, &ConfigError{fmt.Sprintf("USPS packaging %q is no longer offered: USPS retired Regional Rate boxes in 2021", code)}
+	}
+	codes := make([]string, len(Packagings))
+	for i, p := range Packagings {
+		codes[i] = p.Code
+	}
+	return Packaging{}, &ConfigError{fmt.Sprintf("unknown USPS packaging %q (want one of %s)", code, strings.Join(codes, ", "))}
+}
+
+// Request returns a copy of base asking for this container's rates.
+func (p Packaging) Request(base RateRequest) RateRequest {
+	base.MailClasses = p.MailClasses
+	base.RateIndicator = p.RateIndicator
+	base.Length, base.Width, base.Height = p.Length, p.Width, p.Height
+	return base
+}
+
+// Fits reports whether parcel may ship in the container: it is within the
+// weight limit and, side for side, no bigger than the interior. A parcel
+// without dimensions is checked by weight alone.
+func (p Packaging) Fits(parcel Parcel) bool {
+	if parcel.Weight > flatRateMaxWeight {
+		return false
+	}
+	if !parcel.hasDimensions() {
+		return true
+	}
+	length, width, height := parcel.sides()
+	interiorLength, interiorWidth, interiorHeight := Parcel{Length: p.Length, Width: p.Width, Height: p.Height}.sides()
+	return length <= interiorLength && width <= interiorWidth && height <= interiorHeight
+}
+
+// MilitaryOnly reports whether the container may only be sent to
+// APO/FPO/DPO addresses.
+func (p Packaging) MilitaryOnly() bool {
+	return p.RateIndicator == LargeFlatRateBoxAPOFPO
+}
+
+// Accepts reports whether rate is this container's rate.
+func (p Packaging) Accepts(rate Rate) bool {
+	return rate.RateIndicator == p.RateIndicator && rate.DestinationEntryFacilityType == None
+}
@@ -0,0 +1,40 @@
+package usps
+
+import "testing"
+
+func TestPackagingFits(t *testing.T) {
+	small, err := LookupPackaging("small_flat_rate_box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		parcel Parcel
+		want   bool
+	}{
+		{"no dimensions", Parcel{Weight: 2}, true},
+		{"interior size", Parcel{Length: 8.625, Width: 5.375, Height: 1.625, Weight: 2}, true},
+		{"sides in any order", Parcel{Length: 1.5, Width: 8, Height: 5, Weight: 2}, true},
+		{"too long", Parcel{Length: 9, Width: 5, Height: 1.5, Weight: 2}, false},
+		{"too thick", Parcel{Length: 8, Width: 5, Height: 2, Weight: 2}, false},
+		{"much too big", Parcel{Length: 20, Width: 20, Height: 20, Weight: 2}, false},
+		{"too heavy", Parcel{Length: 8, Width: 5, Height: 1, Weight: 70.5}, false},
+		{"too heavy without dimensions", Parcel{Weight: 71}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := small.Fits(tt.parcel); got != tt.want {
+				t.Errorf("Fits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackagingMilitaryOnly(t *testing.T) {
+	for _, p := range Packagings {
+		want := p.Code == "large_flat_rate_box_apo_fpo"
+		if got := p.MilitaryOnly(); got != want {
+			t.Errorf("%s: MilitaryOnly() = %v, want %v", p.Code, got, want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package usps
+
+import (
+	"math"
+	"slices"
+)
+
+// Machinable parcel limits for Priority Mail and Ground Advantage (DMM
+// 201.7.5), in inches and pounds.
+const (
+	machinableMaxLength = 22.0
+	machinableMaxWidth  = 18.0
+	machinableMaxHeight = 15.0
+	machinableMaxWeight = 25.0
+	machinableMinLength = 6.0
+	machinableMinWidth  = 3.0
+	machinableMinHeight = 0.25
+	machinableMinWeight = 6.0 / 16
+)
+
+// Cubic pricing limits: at most 20 lb and 18 inches on the longest side.
+// Priority Mail cubic tiers stop at 0.5 cubic feet; Ground Advantage goes
+// up to 1 cubic foot.
+const (
+	cubicMaxWeight       = 20.0
+	cubicMaxLength       = 18.0
+	cubicMaxTier         = 1.0
+	priorityCubicMaxTier = 0.5
+	cubicInchesCuFt      = 1728.0
+)
+
+// cubicMaxTierFor returns the largest cubic tier mailClass is priced in.
+func cubicMaxTierFor(mailClass MailClass) float64 {
+	if mailClass == PriorityMail {
+		return priorityCubicMaxTier
+	}
+	return cubicMaxTier
+}
+
+// Parcel is a package's dimensions in inches and weight in pounds, used to
+// pick which of the rates USPS returns apply to it.
+type Parcel struct {
+	Length float64
+	Width  float64
+	Height float64
+	Weight float64
+}
+
+// hasDimensions reports whether all three dimensions are known.
+func (p Parcel) hasDimensions() bool {
+	return p.Length > 0 && p.Width > 0 && p.Height > 0
+}
+
+// sides returns the dimensions longest first.
+func (p Parcel) sides() (length, width, height float64) {
+	dims := []float64{p.Length, p.Width, p.Height}
+	slices.Sort(dims)
+	return dims[2], dims[1], dims[0]
+}
+
+// ProcessingCategory returns the category USPS prices the parcel in.
+// Parcels without dimensions are assumed machinable, as they were before
+// dimensions were taken into account.
+func (p Parcel) ProcessingCategory() ProcessingCategory {
+	if p.Weight > machinableMaxWeight || (p.Weight > 0 && p.Weight < machinableMinWeight) {
+		return NonMachinable
+	}
+	if !p.hasDimensions() {
+		return Machinable
+	}
+	l, w, h := p.sides()
+	if l > machinableMaxLength || w > machinableMaxWidth || h > machinableMaxHeight ||
+		l < machinableMinLength || w < machinableMinWidth || h < machinableMinHeight {
+		return NonMachinable
+	}
+	return Machinable
+}
+
+// CubicTier returns the parcel's cubic pricing tier in cubic feet (0.1 to
+// 1.0), or 0 if it isn't eligible for cubic pricing in any mail class. Each dimension is
+// rounded down to the nearest quarter inch and the volume rounded up to the
+// next tenth of a cubic foot.
+func (p Parcel) CubicTier() float64 {
+	if !p.hasDimensions() || p.Weight > cubicMaxWeight {
+		return 0
+	}
+	l, w, h := p.sides()
+	if l > cubicMaxLength {
+		return 0
+	}
+	quarter := func(v float64) float64 { return math.Floor(v*4) / 4 }
+	cuft := quarter(l) * quarter(w) * quarter(h) / cubicInchesCuFt
+	// The epsilon keeps exact tenths from rounding up a tier
+	tier := math.Ceil(cuft*10-1e-9) / 10
+	if tier > cubicMaxTier {
+		return 0
+	}
+	return max(tier, 0.1)
+}
+
+// Accepts reports whether rate applies to the parcel: single-piece rates in
+// its processing category, and cubic rates when its tier is one the rate's
+// mail class offers. Rates
+// requiring destination entry (drop-off at an NDC, SCF or delivery unit)
+// never apply, since we ship from our own warehouse.
+func (p Parcel) Accepts(rate Rate) bool {
+	if rate.DestinationEntryFacilityType != None {
+		return false
+	}
+	switch rate.RateIndicator {
+	case SinglePiece, PriorityExpressSinglePiece:
+		return rate.ProcessingCategory == p.ProcessingCategory()
+	case CubicParcel:
+		tier := p.CubicTier()
+		return tier > 0 && tier <= cubicMaxTierFor(rate.MailClass)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,94 @@
+package usps
+
+import "testing"
+
+func TestParcelProcessingCategory(t *testing.T) {
+	tests := []struct {
+		name   string
+		parcel Parcel
+		want   ProcessingCategory
+	}{
+		{"no dimensions", Parcel{Weight: 2}, Machinable},
+		{"largest machinable", Parcel{Length: 22, Width: 18, Height: 15, Weight: 25}, Machinable},
+		{"sides in any order", Parcel{Length: 15, Width: 22, Height: 18, Weight: 10}, Machinable},
+		{"smallest machinable", Parcel{Length: 6, Width: 3, Height: 0.25, Weight: 6.0 / 16}, Machinable},
+		{"too long", Parcel{Length: 22.5, Width: 10, Height: 10, Weight: 5}, NonMachinable},
+		{"too wide", Parcel{Length: 20, Width: 18.5, Height: 10, Weight: 5}, NonMachinable},
+		{"too short", Parcel{Length: 5.5, Width: 4, Height: 2, Weight: 1}, NonMachinable},
+		{"too narrow", Parcel{Length: 10, Width: 2.5, Height: 1, Weight: 1}, NonMachinable},
+		{"too heavy", Parcel{Length: 10, Width: 8, Height: 6, Weight: 25.5}, NonMachinable},
+		{"too light", Parcel{Length: 10, Width: 8, Height: 6, Weight: 0.25}, NonMachinable},
+		{"too heavy without dimensions", Parcel{Weight: 30}, NonMachinable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.parcel.ProcessingCategory(); got != tt.want {
+				t.Errorf("ProcessingCategory() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParcelCubicTier(t *testing.T) {
+	tests := []struct {
+		name   string
+		parcel Parcel
+		want   float64
+	}{
+		{"no dimensions", Parcel{Weight: 2}, 0},
+		{"rounds volume up to the next tenth", Parcel{Length: 10, Width: 8, Height: 6, Weight: 2}, 0.3},
+		{"smallest tier", Parcel{Length: 4, Width: 4, Height: 4, Weight: 1}, 0.1},
+		{"exact tenth stays in its tier", Parcel{Length: 18, Width: 8, Height: 6, Weight: 2}, 0.5},
+		// 8.2 in floors to 8 in: 0.296 cu ft, not 0.304
+		{"floors sides to a quarter inch", Parcel{Length: 8.2, Width: 8, Height: 8, Weight: 2}, 0.3},
+		{"Ground Advantage tiers", Parcel{Length: 14, Width: 12, Height: 8, Weight: 5}, 0.8},
+		{"one cubic foot", Parcel{Length: 12, Width: 12, Height: 12.2, Weight: 5}, 1.0},
+		{"over one cubic foot", Parcel{Length: 12, Width: 12, Height: 12.3, Weight: 5}, 0},
+		{"18 in longest side", Parcel{Length: 18, Width: 4, Height: 4, Weight: 2}, 0.2},
+		{"over 18 in longest side", Parcel{Length: 18.5, Width: 4, Height: 4, Weight: 2}, 0},
+		{"20 lb", Parcel{Length: 10, Width: 8, Height: 6, Weight: 20}, 0.3},
+		{"over 20 lb", Parcel{Length: 10, Width: 8, Height: 6, Weight: 20.5}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.parcel.CubicTier(); got != tt.want {
+				t.Errorf("CubicTier() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParcelAccepts(t *testing.T) {
+	machinable := Parcel{Length: 10, Width: 8, Height: 6, Weight: 2}
+	nonMachinable := Parcel{Length: 24, Width: 8, Height: 6, Weight: 2}
+	largeCubic := Parcel{Length: 14, Width: 12, Height: 8, Weight: 5}
+
+	rate := func(mailClass MailClass, indicator RateIndicator, category ProcessingCategory, entry DestinationEntryFacilityType) Rate {
+		return Rate{MailClass: mailClass, RateIndicator: indicator, ProcessingCategory: category, DestinationEntryFacilityType: entry}
+	}
+	tests := []struct {
+		name   string
+		parcel Parcel
+		rate   Rate
+		want   bool
+	}{
+		{"machinable single piece", machinable, rate(PriorityMail, SinglePiece, Machinable, None), true},
+		{"non-machinable rate for machinable parcel", machinable, rate(PriorityMail, SinglePiece, NonMachinable, None), false},
+		{"non-machinable single piece", nonMachinable, rate(GroundAdvantage, SinglePiece, NonMachinable, None), true},
+		{"machinable rate for non-machinable parcel", nonMachinable, rate(GroundAdvantage, SinglePiece, Machinable, None), false},
+		{"express single piece", machinable, rate(PriorityMailExpress, PriorityExpressSinglePiece, Machinable, None), true},
+		{"destination entry", machinable, rate(PriorityMail, SinglePiece, Machinable, DDU), false},
+		{"Priority Mail cubic", machinable, rate(PriorityMail, CubicParcel, Machinable, None), true},
+		{"Priority Mail cubic over 0.5 cu ft", largeCubic, rate(PriorityMail, CubicParcel, Machinable, None), false},
+		{"Ground Advantage cubic over 0.5 cu ft", largeCubic, rate(GroundAdvantage, CubicParcel, Machinable, None), true},
+		{"cubic for ineligible parcel", nonMachinable, rate(GroundAdvantage, CubicParcel, Machinable, None), false},
+		{"flat rate", machinable, rate(PriorityMail, FlatRateEnvelope, Machinable, None), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.parcel.Accepts(tt.rate); got != tt.want {
+				t.Errorf("Accepts(%s %s %s) = %v, want %v", tt.rate.MailClass, tt.rate.RateIndicator, tt.rate.ProcessingCategory, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,38 +4,109 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"sync"
 
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
 // RateService represents the USPS API service
 type RateService struct {
 	client  *http.Client
+	tokens  *tokenCache
 	baseURL string
 }
 
-// NewRateService creates a new USPS service instance
-func NewRateService() (*RateService, error) {
-	config, _ := LoadUSPSConfig()
+// NewRateService creates a new USPS service instance. It only validates
+// config; tokens are fetched on first use. Call Authenticate to check the
+// credentials up front.
+func NewRateService(config Config) (*RateService, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.USPSBaseURL == "" {
+		config.USPSBaseURL = DefaultBaseURL
+	}
 
-	auth := &clientcredentials.Config{
-		ClientID:     config.USPSConsumerKey,
-		ClientSecret: config.USPSConsumerSecret,
-		TokenURL:     fmt.Sprintf("%s/oauth2/v3/token", config.USPSBaseURL),
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	tokens := &tokenCache{
+		auth: &clientcredentials.Config{
+			ClientID:     config.USPSConsumerKey,
+			ClientSecret: config.USPSConsumerSecret,
+			TokenURL:     fmt.Sprintf("%s/oauth2/v3/token", config.USPSBaseURL),
+		},
+		httpClient: httpClient,
 	}
 
-	ctx := context.Background()
-	client := auth.Client(ctx)
+	// oauth2.NewClient reuses httpClient's transport but not its timeout
+	client := oauth2.NewClient(context.WithValue(context.Background(), oauth2.HTTPClient, httpClient), tokens)
+	client.Timeout = httpClient.Timeout
 
 	return &RateService{
 		client:  client,
+		tokens:  tokens,
 		baseURL: config.USPSBaseURL,
 	}, nil
 }
 
+// Authenticate obtains an OAuth token with the configured credentials,
+// bounded by ctx, and caches it for rate requests. A still-valid cached
+// token counts as obtained. Credentials USPS rejects are reported as
+// ErrInvalidCredentials; anything else is a failure to reach USPS.
+func (s *RateService) Authenticate(ctx context.Context) error {
+	if _, err := s.tokens.token(ctx); err != nil {
+		return tokenError(err)
+	}
+	return nil
+}
+
+// tokenCache is an oauth2.TokenSource that reuses its token until it
+// expires and can be primed under a caller's context.
+type tokenCache struct {
+	auth       *clientcredentials.Config
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	cached *oauth2.Token
+}
+
+func (c *tokenCache) Token() (*oauth2.Token, error) {
+	return c.token(context.Background())
+}
+
+func (c *tokenCache) token(ctx context.Context) (*oauth2.Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached.Valid() {
+		return c.cached, nil
+	}
+	t, err := c.auth.Token(context.WithValue(ctx, oauth2.HTTPClient, c.httpClient))
+	if err != nil {
+		return nil, err
+	}
+	c.cached = t
+	return t, nil
+}
+
+// tokenError distinguishes credentials USPS rejected from failures to reach
+// the token endpoint.
+func tokenError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response != nil &&
+		(retrieveErr.Response.StatusCode == http.StatusBadRequest || retrieveErr.Response.StatusCode == http.StatusUnauthorized) {
+		return fmt.Errorf("%w: %s", ErrInvalidCredentials, retrieveErr.Error())
+	}
+	return fmt.Errorf("failed to obtain USPS OAuth token: %w", err)
+}
+
 // RateRequest represents the request for a rate quote
 type RateRequest struct {
 	FromZipCode   string      `json:"originZIPCode"`
@@ -48,7 +119,16 @@ type RateRequest struct {
 	PriceType     PriceType   `json:"priceType,omitempty"`
 	MailingDate   string      `json:"mailingDate,omitempty"`
 	AccountType   AccountType `json:"accountType,omitempty"`
-	AccountNumber string      `json:"AccountNumber,omitempty"`
+	AccountNumber string      `json:"accountNumber,omitempty"`
+
+	// RateIndicator narrows the search to one container, such as a flat
+	// rate box
+	RateIndicator RateIndicator `json:"rateIndicator,omitempty"`
+
+	// ExtraServices are priced alongside each rate; insurance is priced on
+	// ItemValue
+	ExtraServices []ExtraService `json:"extraServices,omitempty"`
+	ItemValue     float64        `json:"itemValue,omitempty"`
 }
 
 // Rate represents an individual shipping rate option
@@ -58,7 +138,7 @@ type Rate struct {
 	Price                        float64                      `json:"price"`
 	Weight                       float64                      `json:"weight"`
 	DimWeight                    float64                      `json:"dimWeight"`
-	Fees                         []any                        `json:"fees"`
+	Fees                         []Fee                        `json:"fees"`
 	StartDate                    string                       `json:"startDate"`
 	EndDate                      string                       `json:"endDate"`
 	MailClass                    MailClass                    `json:"mailClass"`
@@ -71,21 +151,43 @@ type Rate struct {
 	SKU                          string                       `json:"SKU"`
 }
 
+// Fee is a charge USPS adds on top of a rate's price, such as the
+// nonstandard length fee.
+type Fee struct {
+	Name  string  `json:"name"`
+	SKU   string  `json:"SKU"`
+	Price float64 `json:"price"`
+}
+
 // RateOption represents a group of rates with their base price
 type RateOption struct {
-	TotalBasePrice float64 `json:"totalBasePrice"`
-	Rates          []Rate  `json:"rates"`
-	ExtraServices  []struct {
-		ExtraService string  `json:"extraService"`
-		Name         string  `json:"name"`
-		PriceType    string  `json:"priceType"`
-		Price        float64 `json:"price"`
-		Warnings     []struct {
-			WarningCode        string `json:"warningCode"`
-			WarningDescription string `json:"warningDescription"`
-		} `json:"warnings"`
-		SKU string `json:"SKU"`
-	} `json:"extraServices"`
+	TotalBasePrice float64              `json:"totalBasePrice"`
+	Rates          []Rate               `json:"rates"`
+	ExtraServices  []ExtraServiceOption `json:"extraServices"`
+}
+
+// ExtraServiceOption is the price of an extra service for a RateOption's
+// rates. ExtraService holds the numeric code as a string, e.g. "930".
+type ExtraServiceOption struct {
+	ExtraService string    `json:"extraService"`
+	Name         string    `json:"name"`
+	PriceType    string    `json:"priceType"`
+	Price        float64   `json:"price"`
+	Warnings     []Warning `json:"warnings"`
+	SKU          string    `json:"SKU"`
+}
+
+// Code parses ExtraService, returning 0 if it isn't numeric.
+func (o ExtraServiceOption) Code() ExtraService {
+	code, _ := strconv.Atoi(o.ExtraService)
+	return ExtraService(code)
+}
+
+// Warning is a note USPS attaches to an extra service, such as a
+// restriction on the destination or mail class.
+type Warning struct {
+	WarningCode        string `json:"warningCode"`
+	WarningDescription string `json:"warningDescription"`
 }
 
 // RateResponse represents the response from the USPS rate API
@@ -93,9 +195,23 @@ type RateResponse struct {
 	RateOptions []RateOption `json:"rateOptions"`
 }
 
+// StatusError is returned when the USPS API answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
 // GetRates retrieves shipping rates from USPS
 func (s *RateService) GetRates(ctx context.Context, req RateRequest) (*RateResponse, error) {
-	url := fmt.Sprintf("%s/prices/v3/total-rates/search", s.baseURL)
+	return s.search(ctx, "/prices/v3/total-rates/search", req)
+}
+
+// search posts a rate search to path and decodes the rate options.
+func (s *RateService) search(ctx context.Context, path string, req any) (*RateResponse, error) {
+	url := s.baseURL + path
 
 	// Convert request to JSON
 	jsonData, err := json.Marshal(req)
@@ -127,7 +243,7 @@ func (s *RateService) GetRates(ctx context.Context, req RateRequest) (*RateRespo
 	//log.Printf("USPS response body: %s", string(body))
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode}
 	}
 
 	// Parse response
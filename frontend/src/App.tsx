@@ -3,6 +3,13 @@ import { ShipmentForm } from './components/ShipmentForm'
 import { RateResults } from './components/RateResults'
 import { ShipmentRequest, Rate, Carrier, ShipHawkError, ShipHawkDebug, QuoteResponse } from './types'
 
+// API key sent with every backend request. It is compiled into the public
+// bundle, so it is not a secret: use a key marked `public: true` in the
+// backend config, which limits it to the quote and carriers scopes.
+const apiKeyHeaders: Record<string, string> = import.meta.env.VITE_API_KEY
+  ? { 'X-API-Key': import.meta.env.VITE_API_KEY }
+  : {}
+
 function App() {
   const [rates, setRates] = useState<Rate[]>([])
   const [errors, setErrors] = useState<ShipHawkError[]>([])
@@ -13,7 +20,7 @@ function App() {
 
   useEffect(() => {
     // Fetch carriers on component mount
-    fetch('/api/carriers')
+    fetch('/api/carriers', { headers: apiKeyHeaders })
       .then(response => response.json())
       .then((data: Carrier[]) => setCarriers(data))
       .catch(error => console.error('Error fetching carriers:', error))
@@ -31,6 +38,7 @@ function App() {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
+          ...apiKeyHeaders,
         },
         body: JSON.stringify(request),
       })